@@ -1,14 +1,19 @@
 package internal
 
 import (
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"jrest/internal/handlers/routing"
+	"jrest/internal/metrics"
 	"jrest/internal/models"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
@@ -19,10 +24,14 @@ var (
 	extensions = []string{"", ".yaml", ".yml", ".json"}
 )
 
+// metricsPath is served ahead of the source's routes.
+const metricsPath = "/metrics"
+
 type App struct {
 	filename string
 	watcher  *fsnotify.Watcher
-	source   *models.Source
+	source   atomic.Value
+	handler  atomic.Value
 }
 
 func NewApp(filename string) *App {
@@ -35,9 +44,10 @@ func NewApp(filename string) *App {
 	app := App{
 		filename: filename,
 		watcher:  watcher,
-		source:   &models.Source{},
 	}
-	app.loadSource()
+	if err = app.loadSource(); err != nil {
+		log.Fatal(err)
+	}
 
 	// Start listening for events.
 	go func(a *App) {
@@ -49,17 +59,19 @@ func NewApp(filename string) *App {
 				}
 				if event.Has(fsnotify.Rename) || event.Has(fsnotify.Remove) {
 					time.Sleep(1 * time.Second)
-					err = watcher.Add(a.filename)
-					if err != nil {
-						log.Fatalf("source file `%s` cannot be found", a.filename)
+					err = watcher.Add(event.Name)
+					if err != nil && event.Name == a.filename {
+						log.Fatalf("source file `%s` cannot be found", event.Name)
+					} else if err != nil {
+						// The reload reports the missing file and keeps the
+						// previous source.
+						log.Printf("unable to watch %s: %v", event.Name, err)
 					}
 					log.Println("modified file:", event.Name)
-					a.loadSource()
-					a.source.LogPaths()
+					a.reload()
 				} else if event.Has(fsnotify.Write) {
 					log.Println("modified file:", event.Name)
-					a.loadSource()
-					a.source.LogPaths()
+					a.reload()
 				}
 			case err, ok := <-watcher.Errors:
 				if !ok {
@@ -70,6 +82,19 @@ func NewApp(filename string) *App {
 		}
 	}(&app)
 
+	// Write a final snapshot on shutdown.
+	go func(a *App) {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		<-signals
+		if source := a.current(); source.Storage != nil {
+			if err := source.Storage.Snapshot(); err != nil {
+				log.Printf("unable to write snapshot: %v", err)
+			}
+		}
+		os.Exit(0)
+	}(&app)
+
 	// Add a path.
 	err = watcher.Add(app.filename)
 	if err != nil {
@@ -79,55 +104,171 @@ func NewApp(filename string) *App {
 	return &app
 }
 
-func (a *App) loadSource() {
+// reload replaces the served source, keeping the previous one if the changed
+// source cannot be loaded.
+func (a *App) reload() {
+	if err := a.loadSource(); err != nil {
+		metrics.Reloads.Inc("failure")
+		log.Printf("%v, keeping the previous source", err)
+		return
+	}
+	metrics.Reloads.Inc("success")
+	a.current().LogPaths()
+}
+
+func (a *App) loadSource() error {
+	filename, bs, err := readSource(a.filename)
+	if err != nil {
+		return err
+	}
+	a.filename = filename
+	source, files, err := parseSource(filename, bs)
+	if err != nil {
+		return err
+	}
+	a.watch(files)
+
+	var current *models.Store
+	previous := a.current()
+	if previous != nil {
+		current = previous.Storage
+	}
+	if err = source.ConfigureMemDB(current); err != nil {
+		return fmt.Errorf("unable to process %s: %w", a.filename, err)
+	}
+	logger, err := source.Logger()
+	if err != nil {
+		return fmt.Errorf("unable to process %s: %w", a.filename, err)
+	}
+	if source.Storage != nil {
+		if err = source.Storage.StartPersist(); err != nil {
+			return fmt.Errorf("unable to process %s: %w", a.filename, err)
+		}
+	}
+
+	// Requests in flight keep the routes they started with.
+	a.source.Store(source)
+	a.handler.Store(routing.BaseHandler(source, logger))
+	if previous != nil && previous.Storage != nil {
+		previous.Storage.StopPersist()
+	}
+	if source.Storage != nil {
+		if err = source.Storage.Rewrite(); err != nil {
+			log.Printf("unable to write snapshot: %v", err)
+		}
+	}
+	if source.Storage != nil {
+		metrics.Rows.Collect(source.Storage.Rows)
+	} else {
+		metrics.Rows.Collect(nil)
+	}
+	return nil
+}
+
+// readSource reads the source file, trying each of the known extensions.
+func readSource(filename string) (string, []byte, error) {
 	var bs []byte
 	var err error
 	for _, extension := range extensions {
-		extendedFilename := fmt.Sprintf("%s%s", a.filename, extension)
+		extendedFilename := fmt.Sprintf("%s%s", filename, extension)
 		bs, err = os.ReadFile(extendedFilename)
 		if err == nil {
-			a.filename = extendedFilename
-			break
+			return extendedFilename, bs, nil
 		}
 	}
-	if err != nil {
-		log.Fatalf("unable to read %s: %v\n", a.filename, err)
-	}
+	return filename, nil, fmt.Errorf("unable to read %s: %w", filename, err)
+}
 
-	switch filepath.Ext(a.filename)[1:] {
+// parseSource decodes and prepares a source, returning it with the names of
+// the files it references.
+func parseSource(filename string, bs []byte) (*models.Source, []string, error) {
+	var err error
+	source := &models.Source{}
+	switch filepath.Ext(filename)[1:] {
 	case "json":
-		err = json.Unmarshal(bs, a.source)
+		err = json.Unmarshal(bs, source)
 	case "yml", "yaml":
-		err = yaml.Unmarshal(bs, a.source)
+		err = yaml.Unmarshal(bs, source)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to process %s: %w", filename, err)
 	}
+
+	source.ApplyDefaults()
+	source.Cleanse()
+	if err = source.ApplyResources(); err != nil {
+		return nil, nil, fmt.Errorf("unable to process %s: %w", filename, err)
+	}
+	if source.Serves(metricsPath) {
+		return nil, nil, fmt.Errorf("unable to process %s: a path collides with %s, set a base to move the paths", filename, metricsPath)
+	}
+	files, err := source.LoadFiles(filepath.Dir(filename))
 	if err != nil {
-		log.Fatalf("unable to process %s: %v", a.filename, err)
+		return nil, nil, fmt.Errorf("unable to process %s: %w", filename, err)
 	}
+	if source.TLS != nil {
+		if _, err = source.TLS.Config(); err != nil {
+			return nil, nil, fmt.Errorf("unable to process %s: %w", filename, err)
+		}
+	}
+	return source, files, nil
+}
+
+// current returns the source being served, which a reload may replace at any
+// time.
+func (a *App) current() *models.Source {
+	source, _ := a.source.Load().(*models.Source)
+	return source
+}
 
-	a.source.ApplyDefaults()
-	a.source.Cleanse()
-	a.source.ConfigureMemDB()
+func (a *App) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.handler.Load().(http.Handler).ServeHTTP(w, r)
+}
+
+func (a *App) watch(files []string) {
+	for _, file := range files {
+		if err := a.watcher.Add(file); err != nil {
+			log.Printf("unable to watch %s: %v", file, err)
+		}
+	}
 }
 
 func (a *App) Serve() {
-	listenAddress := fmt.Sprintf("%s:%d", a.source.Host, a.source.Port)
+	source := a.current()
+	listenAddress := fmt.Sprintf("%s:%d", source.Host, source.Port)
 	mux := http.NewServeMux()
-	mux.Handle("/", routing.BaseHandler(a.source))
+	mux.Handle(metricsPath, metrics.Handler())
+	mux.Handle("/", a)
 
 	protocol := "http"
-	if a.source.TLS != nil {
+	if source.TLS != nil {
 		protocol = "https"
 	}
-	log.Printf("Starting server: %s://%s%s\n", protocol, listenAddress, a.source.Base)
-	a.source.LogPaths()
+	log.Printf("Starting server: %s://%s%s\n", protocol, listenAddress, source.Base)
+	source.LogPaths()
 
 	var err error
-	if a.source.TLS != nil {
-		err = http.ListenAndServeTLS(
-			listenAddress,
-			a.source.TLS.CertFile,
-			a.source.TLS.KeyFile,
-			mux)
+	if source.TLS != nil {
+		var certificate tls.Certificate
+		certificate, err = tls.LoadX509KeyPair(source.TLS.CertFile, source.TLS.KeyFile)
+		if err != nil {
+			log.Fatalf("unable to configure tls: %v", err)
+		}
+		var config *tls.Config
+		config, err = a.tlsConfig(certificate)
+		if err != nil {
+			log.Fatalf("unable to configure tls: %v", err)
+		}
+		// Each handshake reads the client CA bundle of the current source.
+		config.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return a.tlsConfig(certificate)
+		}
+		server := &http.Server{
+			Addr:      listenAddress,
+			Handler:   mux,
+			TLSConfig: config,
+		}
+		err = server.ListenAndServeTLS("", "")
 	} else {
 		err = http.ListenAndServe(listenAddress, mux)
 	}
@@ -135,3 +276,19 @@ func (a *App) Serve() {
 		log.Fatalf("unable to start server: %v", err)
 	}
 }
+
+// tlsConfig returns the TLS configuration of the current source, presenting
+// certificate. A source reloaded without tls keeps the configuration the
+// server started with.
+func (a *App) tlsConfig(certificate tls.Certificate) (*tls.Config, error) {
+	source := a.current()
+	if source.TLS == nil {
+		return nil, nil
+	}
+	config, err := source.TLS.Config()
+	if err != nil {
+		return nil, err
+	}
+	config.Certificates = []tls.Certificate{certificate}
+	return config, nil
+}
@@ -0,0 +1,114 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Export writes the source as yaml with its storage data replaced by the rows
+// the store holds once restored from any persisted state. Data files and
+// generators are dropped, their rows being part of the data.
+func Export(filename string, out io.Writer) error {
+	filename, bs, err := readSource(filename)
+	if err != nil {
+		return err
+	}
+	source, _, err := parseSource(filename, bs)
+	if err != nil {
+		return err
+	}
+	if source.Storage == nil {
+		return fmt.Errorf("%s has no storage", filename)
+	}
+	if err = source.ConfigureMemDB(nil); err != nil {
+		return fmt.Errorf("unable to process %s: %w", filename, err)
+	}
+
+	// Edit the document rather than the decoded source to keep its layout.
+	doc := &yaml.Node{}
+	if err = yaml.Unmarshal(bs, doc); err != nil {
+		return fmt.Errorf("unable to process %s: %w", filename, err)
+	}
+	data := &yaml.Node{}
+	if err = data.Encode(source.Storage.Export()); err != nil {
+		return err
+	}
+	if len(doc.Content) == 0 {
+		return fmt.Errorf("%s is empty", filename)
+	}
+	root := doc.Content[0]
+	storage := mappingValue(root, "storage")
+	if storage == nil {
+		return fmt.Errorf("%s has no storage", filename)
+	}
+	if existing := mappingValue(storage, "data"); existing != nil {
+		*existing = *data
+	} else {
+		storage.Content = append(storage.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: "data"}, data)
+	}
+	// The data now holds the rows read from files and generated, so seeding
+	// them again on load would duplicate them.
+	if entities := mappingValue(storage, "entities"); entities != nil && entities.Kind == yaml.MappingNode {
+		for i := 1; i < len(entities.Content); i += 2 {
+			removeKeys(entities.Content[i], "data_file", "generate")
+		}
+	}
+	if filepath.Ext(filename) == ".json" {
+		blockStyle(root)
+	}
+
+	encoder := yaml.NewEncoder(out)
+	encoder.SetIndent(2)
+	if err = encoder.Encode(doc); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func removeKeys(node *yaml.Node, keys ...string) {
+	if node.Kind != yaml.MappingNode {
+		return
+	}
+	content := node.Content[:0]
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if !contains(keys, node.Content[i].Value) {
+			content = append(content, node.Content[i], node.Content[i+1])
+		}
+	}
+	node.Content = content
+}
+
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// blockStyle drops the flow style and quoting of a json source.
+func blockStyle(node *yaml.Node) {
+	node.Style &^= yaml.FlowStyle
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!str" {
+		node.Style &^= yaml.DoubleQuotedStyle
+	}
+	for _, child := range node.Content {
+		blockStyle(child)
+	}
+}
@@ -1,28 +1,55 @@
 package authentication
 
 import (
-	"context"
 	"jrest/internal/handlers"
+	"jrest/internal/metrics"
 	"jrest/internal/models"
 	"net/http"
 )
 
-func AuthHandler(auth *models.Authentication, next http.Handler) http.Handler {
+func AuthHandler(levels []*models.Authentication, next http.Handler) http.Handler {
+	p := newPolicy(levels)
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ctx := r.Context()
-		if auth != nil && ctx.Value(handlers.Authorized) == nil {
-			if auth.Bearer != nil {
-				BearerHandler(auth.Bearer, next).ServeHTTP(w, r.WithContext(ctx))
-				return
-			} else if auth.Credentials != nil {
-				CredentialsHandler(auth.Credentials, next).ServeHTTP(w, r.WithContext(ctx))
-				return
-			} else {
-				attr := ctx.Value(handlers.Attributes).(map[string]interface{})
-				attr[handlers.AttrAuth] = true
-				r = r.WithContext(context.WithValue(ctx, handlers.Authorized, true))
+		req := handlers.RequestFrom(r.Context())
+		user, f := p.authorize(r)
+		if f != nil {
+			req.AuthError = f.Error()
+			for _, scheme := range f.schemes {
+				metrics.AuthFailures.Inc(scheme)
 			}
+			p.reject(w, f)
+			return
+		}
+		req.Authorized = true
+		if len(user) > 0 {
+			req.User = user
 		}
 		next.ServeHTTP(w, r)
 	})
 }
+
+func (p *policy) reject(w http.ResponseWriter, f *failure) {
+	status := http.StatusUnauthorized
+	response := p.unauthorized
+	if f.forbidden {
+		status = http.StatusForbidden
+		response = p.forbidden
+	}
+	for _, challenge := range f.challenges {
+		w.Header().Add("WWW-Authenticate", challenge)
+	}
+	if response == nil {
+		w.WriteHeader(status)
+		return
+	}
+	for key, value := range response.Headers {
+		w.Header().Set(key, value)
+	}
+	if response.Status != 0 {
+		status = response.Status
+	}
+	w.WriteHeader(status)
+	if response.Content != nil {
+		_, _ = w.Write(append([]byte(*response.Content), []byte("\n")...))
+	}
+}
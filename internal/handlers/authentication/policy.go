@@ -0,0 +1,173 @@
+package authentication
+
+import (
+	"jrest/internal/models"
+	"jrest/internal/security"
+	"net/http"
+	"strings"
+)
+
+const defaultRealm = "jrest"
+
+type failure struct {
+	forbidden  bool
+	schemes    []string
+	reasons    []string
+	challenges []string
+}
+
+func (f *failure) Error() string {
+	return strings.Join(f.reasons, "; ")
+}
+
+// policy is the effective authentication for a route: every level from the
+// source down to the method must pass, except that a level marked public
+// discards its own requirements and those of its ancestors.
+type policy struct {
+	levels       []*rule
+	realm        string
+	unauthorized *models.ErrorResponse
+	forbidden    *models.ErrorResponse
+}
+
+// rule is an authentication block with its schemes built.
+type rule struct {
+	schemes []scheme
+	all     []*rule
+	any     []*rule
+}
+
+func newPolicy(levels []*models.Authentication) *policy {
+	p := &policy{realm: defaultRealm}
+	var required []*models.Authentication
+	for _, level := range levels {
+		if level == nil {
+			continue
+		}
+		if level.Public {
+			required = nil
+		} else {
+			required = append(required, level)
+		}
+		if level.Realm != "" {
+			p.realm = level.Realm
+		}
+		if level.Unauthorized != nil {
+			p.unauthorized = level.Unauthorized
+		}
+		if level.Forbidden != nil {
+			p.forbidden = level.Forbidden
+		}
+	}
+	for _, level := range required {
+		p.levels = append(p.levels, newRule(level, p.realm))
+	}
+	return p
+}
+
+func newRule(auth *models.Authentication, realm string) *rule {
+	r := &rule{schemes: schemes(auth, realm)}
+	for _, sub := range auth.All {
+		r.all = append(r.all, newRule(sub, realm))
+	}
+	for _, sub := range auth.Any {
+		r.any = append(r.any, newRule(sub, realm))
+	}
+	return r
+}
+
+func (p *policy) authorize(r *http.Request) (security.Claims, *failure) {
+	user := security.Claims{}
+	for _, level := range p.levels {
+		claims, f := level.evaluate(r)
+		if f != nil {
+			return nil, f
+		}
+		merge(user, claims)
+	}
+	return user, nil
+}
+
+// evaluate checks a single authentication block. The schemes declared directly
+// on the block are alternatives; every entry of all, and at least one entry of
+// any, must also pass.
+func (rl *rule) evaluate(r *http.Request) (security.Claims, *failure) {
+	claims := security.Claims{}
+
+	if len(rl.schemes) > 0 {
+		var failures []*failure
+		passed := false
+		for _, s := range rl.schemes {
+			c, err := s.authorize(r)
+			if err == nil {
+				merge(claims, c)
+				passed = true
+				break
+			}
+			f := &failure{
+				forbidden: security.IsForbidden(err),
+				schemes:   []string{s.name},
+				reasons:   []string{s.name + ": " + err.Error()},
+			}
+			if challenge := s.challenge(err); challenge != "" {
+				f.challenges = []string{challenge}
+			}
+			failures = append(failures, f)
+		}
+		if !passed {
+			return nil, anyOf(failures)
+		}
+	}
+
+	for _, sub := range rl.all {
+		c, f := sub.evaluate(r)
+		if f != nil {
+			return nil, f
+		}
+		merge(claims, c)
+	}
+
+	if len(rl.any) > 0 {
+		var failures []*failure
+		passed := false
+		for _, sub := range rl.any {
+			c, f := sub.evaluate(r)
+			if f == nil {
+				merge(claims, c)
+				passed = true
+				break
+			}
+			failures = append(failures, f)
+		}
+		if !passed {
+			return nil, anyOf(failures)
+		}
+	}
+	return claims, nil
+}
+
+// anyOf combines the failures of alternatives. If any alternative accepted the
+// caller's credentials but found them insufficient the result is forbidden,
+// otherwise the caller is challenged with every alternative scheme.
+func anyOf(failures []*failure) *failure {
+	combined := &failure{}
+	for _, f := range failures {
+		if f.forbidden {
+			combined.forbidden = true
+		}
+	}
+	for _, f := range failures {
+		combined.schemes = append(combined.schemes, f.schemes...)
+		combined.reasons = append(combined.reasons, f.reasons...)
+		if f.forbidden == combined.forbidden {
+			combined.challenges = append(combined.challenges, f.challenges...)
+		}
+	}
+	return combined
+}
+
+func merge(into, from security.Claims) {
+	for k, v := range from {
+		into[k] = v
+	}
+}
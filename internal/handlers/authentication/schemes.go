@@ -0,0 +1,74 @@
+package authentication
+
+import (
+	"errors"
+	"fmt"
+	"jrest/internal/models"
+	"jrest/internal/security"
+	"net/http"
+)
+
+type scheme struct {
+	name      string
+	authorize func(r *http.Request) (security.Claims, error)
+	challenge func(err error) string
+}
+
+func schemes(auth *models.Authentication, realm string) []scheme {
+	var list []scheme
+	if auth.Bearer != nil {
+		checks := auth.Bearer
+		list = append(list, scheme{
+			name: "bearer",
+			authorize: func(r *http.Request) (security.Claims, error) {
+				return security.BearerAuthorized(r, checks)
+			},
+			challenge: func(err error) string {
+				switch {
+				case errors.Is(err, security.ErrMissing):
+					return fmt.Sprintf(`Bearer realm="%s"`, realm)
+				case security.IsForbidden(err):
+					return fmt.Sprintf(`Bearer realm="%s", error="insufficient_scope"`, realm)
+				}
+				return fmt.Sprintf(`Bearer realm="%s", error="invalid_token"`, realm)
+			},
+		})
+	}
+	if auth.Credentials != nil {
+		list = append(list, scheme{
+			name:      "credentials",
+			authorize: auth.Credentials.Authorized,
+			challenge: func(err error) string {
+				if security.IsForbidden(err) {
+					return ""
+				}
+				return fmt.Sprintf(`Basic realm="%s", charset="UTF-8"`, realm)
+			},
+		})
+	}
+	if auth.ApiKey != nil {
+		list = append(list, scheme{
+			name:      "apikey",
+			authorize: auth.ApiKey.Authorized,
+			challenge: func(err error) string {
+				if security.IsForbidden(err) {
+					return ""
+				}
+				return fmt.Sprintf(`ApiKey realm="%s"`, realm)
+			},
+		})
+	}
+	if auth.ClientCert != nil {
+		list = append(list, scheme{
+			name:      "mtls",
+			authorize: auth.ClientCert.Authorized,
+			challenge: func(err error) string {
+				if security.IsForbidden(err) {
+					return ""
+				}
+				return fmt.Sprintf(`ClientCert realm="%s"`, realm)
+			},
+		})
+	}
+	return list
+}
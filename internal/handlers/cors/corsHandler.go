@@ -0,0 +1,78 @@
+package cors
+
+import (
+	"jrest/internal/models"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// CorsHandler adds the cross-origin headers to responses for allowed origins,
+// including those rejected by authentication so that browsers can read them.
+func CorsHandler(config *models.Cors, next http.Handler) http.Handler {
+	if config == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if allowOrigin(w, config, r.Header.Get("Origin")) && len(config.ExposeHeaders) > 0 {
+			w.Header().Set("Access-Control-Expose-Headers", strings.Join(config.ExposeHeaders, ", "))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func IsPreflight(r *http.Request) bool {
+	return r.Method == http.MethodOptions &&
+		r.Header.Get("Origin") != "" &&
+		r.Header.Get("Access-Control-Request-Method") != ""
+}
+
+// Preflight answers a preflight request for a method served by the path. The
+// headers are left out when the origin or method is not allowed, which the
+// browser reports as a failed request.
+func Preflight(w http.ResponseWriter, r *http.Request, config *models.Cors, allow []string) {
+	if config != nil && allowOrigin(w, config, r.Header.Get("Origin")) {
+		methods := allow
+		if len(config.Methods) > 0 {
+			methods = config.Methods
+		}
+		if contains(methods, r.Header.Get("Access-Control-Request-Method")) {
+			w.Header().Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+			if len(config.Headers) > 0 {
+				w.Header().Set("Access-Control-Allow-Headers", strings.Join(config.Headers, ", "))
+			} else if requested := r.Header.Get("Access-Control-Request-Headers"); requested != "" {
+				w.Header().Set("Access-Control-Allow-Headers", requested)
+				w.Header().Add("Vary", "Access-Control-Request-Headers")
+			}
+			if config.MaxAge > 0 {
+				w.Header().Set("Access-Control-Max-Age", strconv.Itoa(config.MaxAge))
+			}
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func allowOrigin(w http.ResponseWriter, config *models.Cors, origin string) bool {
+	w.Header().Add("Vary", "Origin")
+	if origin == "" || !config.AllowsOrigin(origin) {
+		return false
+	}
+	if config.AnyOrigin() {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+	} else {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+	}
+	if config.AllowCredentials {
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
+	return true
+}
+
+func contains(methods []string, method string) bool {
+	for _, m := range methods {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	return false
+}
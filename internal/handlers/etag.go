@@ -0,0 +1,26 @@
+package handlers
+
+import "strings"
+
+// MatchETag reports whether an If-Match or If-None-Match header lists etag,
+// or is *. Weak tags in the header only match when weak comparison is
+// allowed, as it is for If-None-Match.
+func MatchETag(header, etag string, weak bool) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if strings.HasPrefix(candidate, "W/") {
+			if !weak {
+				continue
+			}
+			candidate = candidate[2:]
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"jrest/internal/security"
+	"net/url"
+	"strings"
+)
+
+// Request carries the per-request state shared along a route's handler chain.
+type Request struct {
+	ID         string
+	Base       string
+	Path       string
+	Method     string
+	Route      string
+	Args       map[string]string
+	Query      url.Values
+	RawQuery   string
+	User       security.Claims
+	Authorized bool
+	AuthError  string
+	IfMatch    string
+}
+
+type requestKey struct{}
+
+func WithRequest(ctx context.Context, req *Request) context.Context {
+	return context.WithValue(ctx, requestKey{}, req)
+}
+
+// RequestFrom returns the request state held by ctx, or an empty one when the
+// context did not pass through the router.
+func RequestFrom(ctx context.Context) *Request {
+	if req, ok := ctx.Value(requestKey{}).(*Request); ok {
+		return req
+	}
+	return &Request{Args: map[string]string{}}
+}
+
+// Subject names the authenticated caller for logging.
+func (r *Request) Subject() string {
+	for _, claim := range []string{"sub", "username"} {
+		if v, ok := r.User[claim]; ok {
+			return fmt.Sprint(v)
+		}
+	}
+	return ""
+}
+
+// Lookup returns the value of a path argument or of a named attribute such as
+// url.path or auth.user.tenant_id.
+func (r *Request) Lookup(key string) (interface{}, bool) {
+	if v, ok := r.Args["{"+key+"}"]; ok {
+		return v, true
+	}
+	switch key {
+	case AttrID:
+		return r.ID, true
+	case AttrBase:
+		return r.Base, true
+	case AttrPath:
+		return r.Path, true
+	case AttrMethod:
+		return r.Method, true
+	case AttrRoute:
+		return r.Route, true
+	case AttrAuth:
+		return r.Authorized, true
+	case AttrPathArgs:
+		return r.Args, true
+	case AttrQuery:
+		return r.Query, true
+	case AttrUser:
+		return r.User, r.User != nil
+	}
+	if strings.HasPrefix(key, AttrQuery+".") {
+		values, ok := r.Query[key[len(AttrQuery)+1:]]
+		if !ok || len(values) == 0 {
+			return nil, false
+		}
+		return values[0], true
+	}
+	if strings.HasPrefix(key, AttrUser+".") {
+		var v interface{} = map[string]interface{}(r.User)
+		for _, part := range strings.Split(key[len(AttrUser)+1:], ".") {
+			var m map[string]interface{}
+			switch x := v.(type) {
+			case map[string]interface{}:
+				m = x
+			case security.Claims:
+				m = x
+			default:
+				return nil, false
+			}
+			var ok bool
+			if v, ok = m[part]; !ok {
+				return nil, false
+			}
+		}
+		return v, true
+	}
+	return nil, false
+}
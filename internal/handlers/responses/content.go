@@ -0,0 +1,14 @@
+package responses
+
+import (
+	"jrest/internal/handlers"
+	"strings"
+)
+
+// substitute replaces path argument placeholders such as {name} in content.
+func substitute(content string, req *handlers.Request) string {
+	for k, v := range req.Args {
+		content = strings.ReplaceAll(content, k, v)
+	}
+	return content
+}
@@ -0,0 +1,35 @@
+package responses
+
+import (
+	"fmt"
+	"jrest/internal/handlers"
+	"jrest/internal/models"
+	"net/http"
+)
+
+func deleteHandler(response *models.Response, store *models.Store) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := handlers.RequestFrom(r.Context())
+		if store == nil {
+			writeError(w, fmt.Errorf("no storage configured"))
+			return
+		}
+
+		if _, err := store.Delete(response.Delete, req); err != nil {
+			writeError(w, err)
+			return
+		}
+
+		for key, value := range response.Headers {
+			w.Header().Set(key, value)
+		}
+		status := http.StatusNoContent
+		if response.Status != 0 {
+			status = response.Status
+		}
+		w.WriteHeader(status)
+		if response.Content != nil {
+			_, _ = w.Write(append([]byte(substitute(*response.Content, req)), []byte("\n")...))
+		}
+	})
+}
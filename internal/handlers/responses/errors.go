@@ -0,0 +1,26 @@
+package responses
+
+import (
+	"errors"
+	"jrest/internal/models"
+	"net/http"
+)
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	content := err.Error()
+	var statusErr *models.StatusError
+	if errors.As(err, &statusErr) {
+		status = statusErr.Status
+		if response := statusErr.Response; response != nil {
+			for key, value := range response.Headers {
+				w.Header().Set(key, value)
+			}
+			if response.Content != nil {
+				content = *response.Content
+			}
+		}
+	}
+	w.WriteHeader(status)
+	_, _ = w.Write(append([]byte(content), []byte("\n")...))
+}
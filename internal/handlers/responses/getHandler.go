@@ -1,19 +1,15 @@
 package responses
 
 import (
-	"fmt"
 	"jrest/internal/handlers"
 	"jrest/internal/models"
 	"net/http"
 	"strings"
 )
 
-func getHandler(response *models.Response) http.Handler {
+func getHandler(response *models.Response, store *models.Store) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ctx := r.Context()
-		path := ctx.Value(handlers.Path).(string)
-		attr := ctx.Value(handlers.Attributes).(map[string]interface{})
-		args := attr[handlers.AttrPathArgs].(map[string]string)
+		req := handlers.RequestFrom(r.Context())
 		for key, value := range response.Headers {
 			w.Header().Set(key, value)
 		}
@@ -21,29 +17,28 @@ func getHandler(response *models.Response) http.Handler {
 		respData := ""
 		if response.Content != nil {
 			respData = *response.Content
-		} else if response.Select != nil && ctx.Value(handlers.Store) != nil {
-			db := ctx.Value(handlers.Store).(*models.Store)
-			bs, err := db.Select(response.Select, args)
+		} else if response.Select != nil && store != nil {
+			bs, etag, err := store.Select(response.Select, req)
 			if err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
-				handlers.AuditLog(r.Method, path, fmt.Sprintf("%d", response.Status))
-				respData = err.Error()
+				writeError(w, err)
 				return
 			}
+			if etag != "" {
+				w.Header().Set("ETag", etag)
+				if (r.Method == http.MethodGet || r.Method == http.MethodHead) &&
+					handlers.MatchETag(strings.Join(r.Header.Values("If-None-Match"), ","), etag, true) {
+					w.WriteHeader(http.StatusNotModified)
+					return
+				}
+			}
 			respData = string(bs)
 		}
 
 		if response.Status != 0 {
 			w.WriteHeader(response.Status)
-			handlers.AuditLog(r.Method, path, fmt.Sprintf("%d", response.Status))
 		}
 
-		for k, v := range args {
-			respData = strings.ReplaceAll(respData, k, v)
-		}
+		respData = substitute(respData, req)
 		_, _ = w.Write(append([]byte(respData), []byte("\n")...))
-		if response.Status == 0 {
-			handlers.AuditLog(r.Method, path, "200")
-		}
 	})
 }
@@ -0,0 +1,47 @@
+package responses
+
+import (
+	"fmt"
+	"io"
+	"jrest/internal/handlers"
+	"jrest/internal/models"
+	"net/http"
+)
+
+func insertHandler(response *models.Response, store *models.Store) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := handlers.RequestFrom(r.Context())
+		if store == nil {
+			writeError(w, fmt.Errorf("no storage configured"))
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		bs, etag, err := store.Insert(response.Insert, req, body)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		if etag != "" {
+			w.Header().Set("ETag", etag)
+		}
+		for key, value := range response.Headers {
+			w.Header().Set(key, value)
+		}
+		status := http.StatusCreated
+		if response.Status != 0 {
+			status = response.Status
+		}
+		respData := string(bs)
+		if response.Content != nil {
+			respData = substitute(*response.Content, req)
+		}
+		w.WriteHeader(status)
+		_, _ = w.Write(append([]byte(respData), []byte("\n")...))
+	})
+}
@@ -1,22 +1,23 @@
 package responses
 
 import (
-	"jrest/internal/handlers"
 	"jrest/internal/models"
 	"net/http"
 )
 
-func ResponseHandler(response *models.Response) http.Handler {
+// ResponseHandler returns the handler serving response for method.
+func ResponseHandler(method string, response *models.Response, store *models.Store) http.Handler {
+	switch {
+	case response.Insert != nil:
+		return insertHandler(response, store)
+	case response.Update != nil:
+		return updateHandler(response, store)
+	case response.Delete != nil:
+		return deleteHandler(response, store)
+	case method == http.MethodGet || method == models.MethodAny:
+		return getHandler(response, store)
+	}
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ctx := r.Context()
-		path := ctx.Value(handlers.Path).(string)
-		switch r.Method {
-		case http.MethodGet:
-			getHandler(response).ServeHTTP(w, r)
-		default:
-			w.WriteHeader(http.StatusGone)
-			handlers.AuditLog(r.Method, path, "Not implemented")
-			return
-		}
+		w.WriteHeader(http.StatusGone)
 	})
 }
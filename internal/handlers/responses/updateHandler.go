@@ -0,0 +1,70 @@
+package responses
+
+import (
+	"fmt"
+	"io"
+	"jrest/internal/handlers"
+	"jrest/internal/models"
+	"mime"
+	"net/http"
+)
+
+func updateHandler(response *models.Response, store *models.Store) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := handlers.RequestFrom(r.Context())
+		if store == nil {
+			writeError(w, fmt.Errorf("no storage configured"))
+			return
+		}
+
+		action := models.ActionReplace
+		if r.Method == http.MethodPatch {
+			action = models.ActionPatch
+		}
+		if response.Update.Action != "" {
+			action = response.Update.Action
+		}
+		if action == models.ActionPatch {
+			switch mediaType(r) {
+			case models.MediaMergePatch:
+				action = models.ActionMergePatch
+			case models.MediaJSONPatch:
+				action = models.ActionJSONPatch
+			}
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		bs, etag, err := store.Update(response.Update, req, body, action)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		if etag != "" {
+			w.Header().Set("ETag", etag)
+		}
+		for key, value := range response.Headers {
+			w.Header().Set(key, value)
+		}
+		status := http.StatusOK
+		if response.Status != 0 {
+			status = response.Status
+		}
+		respData := string(bs)
+		if response.Content != nil {
+			respData = substitute(*response.Content, req)
+		}
+		w.WriteHeader(status)
+		_, _ = w.Write(append([]byte(respData), []byte("\n")...))
+	})
+}
+
+// mediaType returns the media type of a request's body, without parameters.
+func mediaType(r *http.Request) string {
+	media, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return media
+}
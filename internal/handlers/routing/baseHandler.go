@@ -1,36 +1,63 @@
 package routing
 
 import (
-	"context"
 	"jrest/internal/handlers"
-	auth2 "jrest/internal/handlers/authentication"
+	"jrest/internal/logging"
 	"jrest/internal/models"
 	"net/http"
 	"strings"
 )
 
-func BaseHandler(source *models.Source) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if !strings.HasPrefix(r.URL.Path, source.Base) {
-			w.WriteHeader(http.StatusNotFound)
-			handlers.AuditLog(r.Method, r.URL.Path, "Not found")
-			return
-		}
-		path := r.URL.Path[len(source.Base)+1:]
-		attr := make(map[string]interface{})
-		attr[handlers.AttrBase] = source.Base
-		attr[handlers.AttrPath] = path
+// Router serves a source through handler chains that are built once, when the
+// source is loaded, rather than for every request.
+type Router struct {
+	base   string
+	paths  *models.Paths
+	routes map[*models.Path]http.Handler
+}
+
+func BaseHandler(source *models.Source, logger *logging.Logger) http.Handler {
+	var store *models.Store
+	if source.Storage != nil && source.Storage.DB != nil {
+		store = source.Storage
+	}
+	router := &Router{
+		base:   source.Base,
+		paths:  &source.Paths,
+		routes: make(map[*models.Path]http.Handler),
+	}
+	for _, path := range source.Paths.All() {
+		router.routes[path] = PathHandler(source, path, store)
+	}
+	return LogHandler(logger, MetricsHandler(router))
+}
 
-		ctx := r.Context()
-		ctx = context.WithValue(ctx, handlers.Attributes, attr)
-		ctx = context.WithValue(ctx, handlers.Path, path)
-		if source.Storage.DB != nil {
-			ctx = context.WithValue(ctx, handlers.Store, source.Storage)
-		}
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path, ok := rt.strip(r.URL.Path)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	match, ok := rt.paths.MatchPath(path)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	req := handlers.RequestFrom(r.Context())
+	req.Base = rt.base
+	req.Path = path
+	req.Method = r.Method
+	req.Route = match.Template
+	req.Args = match.Args
+	req.Query = r.URL.Query()
+	req.RawQuery = r.URL.RawQuery
+	req.IfMatch = strings.Join(r.Header.Values("If-Match"), ",")
+	rt.routes[match.Path].ServeHTTP(w, r.WithContext(handlers.WithRequest(r.Context(), req)))
+}
 
-		auth := source.Authentication
-		next := PathHandler(source.Paths)
-		r = r.WithContext(ctx)
-		auth2.AuthHandler(auth, next).ServeHTTP(w, r)
-	})
+// strip removes the base from a request path, which must equal the base or
+// continue it with a slash.
+func (rt *Router) strip(path string) (string, bool) {
+	return models.StripBase(rt.base, path)
 }
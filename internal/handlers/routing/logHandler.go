@@ -0,0 +1,99 @@
+package routing
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"jrest/internal/handlers"
+	"jrest/internal/logging"
+	"net"
+	"net/http"
+	"time"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// LogHandler writes one record for each request once it has been served. The
+// request ID is taken from X-Request-ID when the caller sends one and is
+// returned in the same header.
+func LogHandler(logger *logging.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		req := &handlers.Request{ID: requestID(r), Args: map[string]string{}}
+		w.Header().Set(requestIDHeader, req.ID)
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r.WithContext(handlers.WithRequest(r.Context(), req)))
+
+		status := sw.code()
+		level := logging.LevelInfo
+		if status >= http.StatusInternalServerError {
+			level = logging.LevelError
+		} else if status >= http.StatusBadRequest {
+			level = logging.LevelWarn
+		}
+		remote, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			remote = r.RemoteAddr
+		}
+		logger.Log(level, "request",
+			"id", req.ID,
+			"remote", remote,
+			"method", r.Method,
+			"path", r.URL.Path,
+			"route", req.Route,
+			"status", status,
+			"bytes", sw.bytes,
+			"latency_ms", float64(time.Since(start).Microseconds())/1000,
+			"user", req.Subject(),
+			"auth_error", req.AuthError,
+		)
+	})
+}
+
+func requestID(r *http.Request) string {
+	if id := r.Header.Get(requestIDHeader); id != "" && len(id) <= 128 && printable(id) {
+		return id
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+func printable(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < 0x21 || s[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (w *statusWriter) code() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += n
+	return n, err
+}
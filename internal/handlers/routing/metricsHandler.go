@@ -0,0 +1,30 @@
+package routing
+
+import (
+	"jrest/internal/handlers"
+	"jrest/internal/metrics"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// MetricsHandler counts requests and their latency by route template. Methods
+// outside the standard set are counted as OTHER.
+func MetricsHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r)
+
+		method := "OTHER"
+		for _, m := range standardMethods {
+			if r.Method == m {
+				method = m
+			}
+		}
+		route := handlers.RequestFrom(r.Context()).Route
+		status := strconv.Itoa(sw.code())
+		metrics.Requests.Inc(route, method, status)
+		metrics.Latency.Observe(time.Since(start).Seconds(), route, method, status)
+	})
+}
@@ -1,24 +1,96 @@
 package routing
 
 import (
-	"jrest/internal/handlers"
-	auth2 "jrest/internal/handlers/authentication"
+	"jrest/internal/handlers/cors"
 	"jrest/internal/models"
 	"net/http"
+	"sort"
+	"strings"
 )
 
-func PathHandler(paths models.Paths) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ctx := r.Context()
-		path := ctx.Value(handlers.Path).(string)
-		body, ok := paths.MatchPath(ctx, path)
+// standardMethods are the methods allowed by a path that serves ANY.
+var standardMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+	http.MethodPatch, http.MethodDelete, http.MethodOptions,
+}
+
+type pathHandler struct {
+	methods map[string]http.Handler
+	cors    map[string]*models.Cors
+	any     http.Handler
+	allowed []string
+	allow   string
+}
+
+// PathHandler builds the handler chain for each method of a path. HEAD is
+// served by GET unless listed, OPTIONS reports the allowed methods unless
+// listed, and ANY serves every other method. CORS preflights are answered
+// with the configuration of the requested method.
+func PathHandler(source *models.Source, path *models.Path, store *models.Store) http.Handler {
+	h := &pathHandler{
+		methods: make(map[string]http.Handler, len(path.Methods)),
+		cors:    make(map[string]*models.Cors, len(path.Methods)),
+	}
+	for method, response := range path.Methods {
+		method = strings.ToUpper(method)
+		config := models.NearestCors(source.Cors, path.Cors, response.Cors)
+		h.cors[method] = config
+		next := MethodHandler(method, response, store, config, source.Authentication, path.Authentication)
+		if method == models.MethodAny {
+			h.any = next
+		} else {
+			h.methods[method] = next
+		}
+	}
+	if get, ok := h.methods[http.MethodGet]; ok {
+		if _, ok = h.methods[http.MethodHead]; !ok {
+			// net/http discards the body written in response to HEAD.
+			h.methods[http.MethodHead] = get
+			h.cors[http.MethodHead] = h.cors[http.MethodGet]
+		}
+	}
+
+	allowed := standardMethods
+	if h.any == nil {
+		allowed = []string{http.MethodOptions}
+		for method := range h.methods {
+			if method != http.MethodOptions {
+				allowed = append(allowed, method)
+			}
+		}
+		sort.Strings(allowed)
+	}
+	h.allowed = allowed
+	h.allow = strings.Join(allowed, ", ")
+	if _, ok := h.methods[http.MethodOptions]; !ok {
+		h.methods[http.MethodOptions] = http.HandlerFunc(h.options)
+	}
+	return h
+}
+
+func (h *pathHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if cors.IsPreflight(r) {
+		method := strings.ToUpper(r.Header.Get("Access-Control-Request-Method"))
+		config, ok := h.cors[method]
 		if !ok {
-			w.WriteHeader(http.StatusNotFound)
-			handlers.AuditLog(r.Method, path, "Not found")
-			return
+			config = h.cors[models.MethodAny]
 		}
-		auth := body.Authentication
-		next := MethodHandler(body.Methods)
-		auth2.AuthHandler(auth, next).ServeHTTP(w, r.WithContext(ctx))
-	})
+		cors.Preflight(w, r, config, h.allowed)
+		return
+	}
+	next, ok := h.methods[r.Method]
+	if !ok {
+		next = h.any
+	}
+	if next == nil {
+		w.Header().Set("Allow", h.allow)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	next.ServeHTTP(w, r)
+}
+
+func (h *pathHandler) options(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Allow", h.allow)
+	w.WriteHeader(http.StatusNoContent)
 }
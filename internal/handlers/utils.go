@@ -1,25 +1,13 @@
 package handlers
 
-import (
-	"log"
-)
-
-const (
-	Attributes = 1
-	Authorized = 2
-	Path       = 3
-	Store      = 4
-)
-
 const (
 	AttrBase     = "url.base"
 	AttrPath     = "url.path"
 	AttrMethod   = "url.method"
+	AttrRoute    = "url.route"
 	AttrAuth     = "_.authorized"
 	AttrUser     = "auth.user"
 	AttrPathArgs = "url.args"
+	AttrQuery    = "url.query"
+	AttrID       = "request.id"
 )
-
-func AuditLog(method, path, status string) {
-	log.Printf("Serving: %s:%s -> %s\n", method, path, status)
-}
@@ -0,0 +1,127 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = []string{"DEBUG", "INFO", "WARN", "ERROR"}
+
+func (l Level) String() string {
+	if l < LevelDebug || l > LevelError {
+		return fmt.Sprintf("LEVEL(%d)", int(l))
+	}
+	return levelNames[l]
+}
+
+func ParseLevel(s string) (Level, error) {
+	for i, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			return Level(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown log level: %s", s)
+}
+
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Logger writes one record per line, either as key=value pairs or as a JSON
+// object, with the time, level and message followed by the given attributes.
+type Logger struct {
+	mu    sync.Mutex
+	out   io.Writer
+	json  bool
+	level Level
+}
+
+func New(out io.Writer, format string, level Level) (*Logger, error) {
+	switch format {
+	case "", FormatText:
+		return &Logger{out: out, level: level}, nil
+	case FormatJSON:
+		return &Logger{out: out, json: true, level: level}, nil
+	}
+	return nil, fmt.Errorf("unknown log format: %s", format)
+}
+
+func (l *Logger) Enabled(level Level) bool {
+	return level >= l.level
+}
+
+func (l *Logger) Debug(msg string, args ...interface{}) { l.Log(LevelDebug, msg, args...) }
+func (l *Logger) Info(msg string, args ...interface{})  { l.Log(LevelInfo, msg, args...) }
+func (l *Logger) Warn(msg string, args ...interface{})  { l.Log(LevelWarn, msg, args...) }
+func (l *Logger) Error(msg string, args ...interface{}) { l.Log(LevelError, msg, args...) }
+
+// Log writes a record with the attributes given as alternating keys and
+// values. Attributes with empty string values are left out.
+func (l *Logger) Log(level Level, msg string, args ...interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+	buf := &bytes.Buffer{}
+	l.attr(buf, "time", time.Now().Format(time.RFC3339Nano))
+	l.attr(buf, "level", level.String())
+	l.attr(buf, "msg", msg)
+	for i := 0; i+1 < len(args); i += 2 {
+		if s, ok := args[i+1].(string); ok && s == "" {
+			continue
+		}
+		l.attr(buf, fmt.Sprint(args[i]), args[i+1])
+	}
+	if l.json {
+		buf.WriteByte('}')
+	}
+	buf.WriteByte('\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, _ = l.out.Write(buf.Bytes())
+}
+
+func (l *Logger) attr(buf *bytes.Buffer, key string, value interface{}) {
+	if l.json {
+		if buf.Len() == 0 {
+			buf.WriteByte('{')
+		} else {
+			buf.WriteByte(',')
+		}
+		k, _ := json.Marshal(key)
+		buf.Write(k)
+		buf.WriteByte(':')
+		v, err := json.Marshal(value)
+		if err != nil {
+			v, _ = json.Marshal(fmt.Sprint(value))
+		}
+		buf.Write(v)
+		return
+	}
+	if buf.Len() > 0 {
+		buf.WriteByte(' ')
+	}
+	buf.WriteString(key)
+	buf.WriteByte('=')
+	s := fmt.Sprint(value)
+	if s == "" || strings.ContainsAny(s, " =\"\t\n") {
+		s = strconv.Quote(s)
+	}
+	buf.WriteString(s)
+}
@@ -0,0 +1,213 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Buckets are the upper bounds, in seconds, of the latency histograms.
+var Buckets = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+var (
+	Requests = newCounter("jrest_http_requests_total",
+		"Requests served, by route template, method and status.", "route", "method", "status")
+	Latency = newHistogram("jrest_http_request_duration_seconds",
+		"Request latency in seconds, by route template, method and status.", "route", "method", "status")
+	AuthFailures = newCounter("jrest_auth_failures_total",
+		"Authentication failures, by scheme.", "scheme")
+	Reloads = newCounter("jrest_reloads_total",
+		"Source reloads, by result.", "result")
+	Rows = newGauge("jrest_memdb_rows",
+		"Rows held in the database, by entity.", "entity")
+)
+
+type metric interface {
+	write(w *bufio.Writer)
+}
+
+var registry []metric
+
+type family struct {
+	name   string
+	help   string
+	labels []string
+}
+
+func (f *family) header(w *bufio.Writer, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, kind)
+}
+
+// series formats the label set of a series, e.g. {route="users",method="GET"}.
+// Extra pairs, such as a histogram's le, are appended.
+func (f *family) series(values []string, extra ...string) string {
+	pairs := make([]string, 0, len(values)+len(extra)/2)
+	for i, label := range f.labels {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, label, escape(values[i])))
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, extra[i], escape(extra[i+1])))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func escape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+func key(values []string) string {
+	return strings.Join(values, "\xff")
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+type Counter struct {
+	family
+	mu     sync.Mutex
+	values map[string]*counterValue
+}
+
+type counterValue struct {
+	labels []string
+	count  uint64
+}
+
+func newCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{family: family{name, help, labels}, values: make(map[string]*counterValue)}
+	registry = append(registry, c)
+	return c
+}
+
+// Inc adds one to the series with the given label values.
+func (c *Counter) Inc(values ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	k := key(values)
+	v, ok := c.values[k]
+	if !ok {
+		v = &counterValue{labels: values}
+		c.values[k] = v
+	}
+	v.count++
+}
+
+func (c *Counter) write(w *bufio.Writer) {
+	c.header(w, "counter")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, k := range sortedKeys(c.values) {
+		v := c.values[k]
+		fmt.Fprintf(w, "%s%s %d\n", c.name, c.series(v.labels), v.count)
+	}
+}
+
+type Histogram struct {
+	family
+	mu     sync.Mutex
+	values map[string]*histogramValue
+}
+
+type histogramValue struct {
+	labels []string
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func newHistogram(name, help string, labels ...string) *Histogram {
+	h := &Histogram{family: family{name, help, labels}, values: make(map[string]*histogramValue)}
+	registry = append(registry, h)
+	return h
+}
+
+// Observe records a value in the series with the given label values.
+func (h *Histogram) Observe(value float64, values ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	k := key(values)
+	v, ok := h.values[k]
+	if !ok {
+		v = &histogramValue{labels: values, counts: make([]uint64, len(Buckets))}
+		h.values[k] = v
+	}
+	for i, bound := range Buckets {
+		if value <= bound {
+			v.counts[i]++
+		}
+	}
+	v.count++
+	v.sum += value
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.header(w, "histogram")
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, k := range sortedKeys(h.values) {
+		v := h.values[k]
+		for i, bound := range Buckets {
+			le := strconv.FormatFloat(bound, 'g', -1, 64)
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.series(v.labels, "le", le), v.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.series(v.labels, "le", "+Inf"), v.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, h.series(v.labels), strconv.FormatFloat(v.sum, 'g', -1, 64))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, h.series(v.labels), v.count)
+	}
+}
+
+// Gauge reports values read when the metrics are scraped, keyed on the value
+// of its single label.
+type Gauge struct {
+	family
+	collect atomic.Value
+}
+
+func newGauge(name, help string, label string) *Gauge {
+	g := &Gauge{family: family{name, help, []string{label}}}
+	registry = append(registry, g)
+	return g
+}
+
+// Collect sets the function that reads the gauge's values.
+func (g *Gauge) Collect(fn func() map[string]int) {
+	g.collect.Store(fn)
+}
+
+func (g *Gauge) write(w *bufio.Writer) {
+	g.header(w, "gauge")
+	fn, ok := g.collect.Load().(func() map[string]int)
+	if !ok || fn == nil {
+		return
+	}
+	values := fn()
+	for _, k := range sortedKeys(values) {
+		fmt.Fprintf(w, "%s%s %d\n", g.name, g.series([]string{k}), values[k])
+	}
+}
+
+// Handler serves every metric in the Prometheus text exposition format.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		bw := bufio.NewWriter(w)
+		for _, m := range registry {
+			m.write(bw)
+		}
+		_ = bw.Flush()
+	})
+}
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"path"
+	"strings"
+)
+
+// Cors configures cross-origin access. Like auth it may be set on the source,
+// a path or a method, but the most specific block replaces the others rather
+// than adding to them. Origins may contain * wildcards, e.g.
+// https://*.example.com. When Methods or Headers are empty a preflight allows
+// the path's methods and the requested headers.
+type Cors struct {
+	Origins          []string `json:"origins" yaml:"origins"`
+	Methods          []string `json:"methods,omitempty" yaml:"methods,omitempty"`
+	Headers          []string `json:"headers,omitempty" yaml:"headers,omitempty"`
+	ExposeHeaders    []string `json:"expose_headers,omitempty" yaml:"expose_headers,omitempty"`
+	AllowCredentials bool     `json:"allow_credentials,omitempty" yaml:"allow_credentials,omitempty"`
+	MaxAge           int      `json:"max_age,omitempty" yaml:"max_age,omitempty"`
+}
+
+// NearestCors returns the last configured block.
+func NearestCors(levels ...*Cors) *Cors {
+	for i := len(levels) - 1; i >= 0; i-- {
+		if levels[i] != nil {
+			return levels[i]
+		}
+	}
+	return nil
+}
+
+func (c *Cors) AllowsOrigin(origin string) bool {
+	for _, pattern := range c.Origins {
+		if pattern == "*" || strings.EqualFold(pattern, origin) {
+			return true
+		}
+		if ok, _ := path.Match(lower.String(pattern), lower.String(origin)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// AnyOrigin reports whether the wildcard origin may be returned as is, which
+// browsers refuse for requests with credentials.
+func (c *Cors) AnyOrigin() bool {
+	if c.AllowCredentials {
+		return false
+	}
+	for _, pattern := range c.Origins {
+		if pattern == "*" {
+			return true
+		}
+	}
+	return false
+}
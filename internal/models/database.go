@@ -3,9 +3,13 @@ package models
 import (
 	"encoding/json"
 	"fmt"
+	"jrest/internal/handlers"
 	"jrest/internal/models/enums/datatype"
 	"log"
+	"net/http"
 	"reflect"
+	"sort"
+	"strings"
 
 	"github.com/hashicorp/go-memdb"
 	"golang.org/x/text/cases"
@@ -21,17 +25,29 @@ var (
 type Store struct {
 	Entities Entities          `json:"entities" yaml:"entities"`
 	Data     map[string][]Data `json:"data,omitempty" yaml:"data,omitempty"`
+	Persist  *Persist          `json:"persist,omitempty" yaml:"persist,omitempty"`
 	DB       *memdb.MemDB
+	links    []*link
 }
 type Data map[string]interface{}
 type Entities map[string]*Entity
 type Entity struct {
-	Table   Table             `json:"fields" yaml:"fields"`
-	Indexes map[string]*Index `json:"indexes" yaml:"indexes"`
+	Table     Table                `json:"fields" yaml:"fields"`
+	Indexes   map[string]*Index    `json:"indexes" yaml:"indexes"`
+	Owner     *Owner               `json:"owner,omitempty" yaml:"owner,omitempty"`
+	DataFile  *DataFile            `json:"data_file,omitempty" yaml:"data_file,omitempty"`
+	Generate  *Generate            `json:"generate,omitempty" yaml:"generate,omitempty"`
+	Relations map[string]*Relation `json:"relations,omitempty" yaml:"relations,omitempty"`
+	Version   string               `json:"version,omitempty" yaml:"version,omitempty"`
+}
+type Owner struct {
+	Field string `json:"field" yaml:"field"`
+	Claim string `json:"claim" yaml:"claim"`
 }
 type Table struct {
 	structType reflect.Type
 	fields     Fields
+	defs       map[string]*Field
 }
 type Fields map[string]datatype.DataType
 type Index struct {
@@ -51,12 +67,16 @@ func (s *Store) buildSchema() *memdb.DBSchema {
 		for name, index := range definition.Indexes {
 			if index == nil {
 				index = &Index{Field: name}
+				definition.Indexes[name] = index
 			}
 			index.name = name
+			// Rows without a value, such as those given a new field by a
+			// migration, are left out of all but the id index.
 			indexes[lower.String(name)] = &memdb.IndexSchema{
-				Name:    lower.String(name),
-				Unique:  index.Unique,
-				Indexer: definition.Table.fields.Indexer(index),
+				Name:         lower.String(name),
+				Unique:       index.Unique,
+				AllowMissing: lower.String(name) != "id",
+				Indexer:      definition.Table.fields.Indexer(index),
 			}
 		}
 		table.Indexes = indexes
@@ -68,37 +88,51 @@ func (s *Store) buildSchema() *memdb.DBSchema {
 }
 
 func (t *Table) UnmarshalYAML(value *yaml.Node) error {
-	*t = Table{
-		fields: make(Fields),
-	}
+	defs := make(map[string]*Field)
 	for index := 0; index < len(value.Content); index += 2 {
-		name := lower.String(value.Content[index].Value)
-		d := datatype.DataTypeOf(value.Content[index+1].Value)
-		t.fields[name] = d
+		def := &Field{}
+		if err := value.Content[index+1].Decode(def); err != nil {
+			return fmt.Errorf("field %s: %w", value.Content[index].Value, err)
+		}
+		defs[lower.String(value.Content[index].Value)] = def
 	}
-	t.mapToStruct()
+	t.define(defs)
 	return nil
 }
 func (t *Table) UnmarshalJSON(data []byte) error {
-	tmp := make(map[string]string)
+	tmp := make(map[string]*Field)
 	err := json.Unmarshal(data, &tmp)
 	if err != nil {
 		return err
 	}
+	defs := make(map[string]*Field)
+	for name, def := range tmp {
+		defs[lower.String(name)] = def
+	}
+	t.define(defs)
+	return nil
+}
+func (t *Table) define(defs map[string]*Field) {
 	*t = Table{
-		fields: make(map[string]datatype.DataType),
+		fields: make(Fields),
+		defs:   defs,
 	}
-	for name, value := range tmp {
-		d := datatype.DataTypeOf(value)
-		t.fields[lower.String(name)] = d
+	for name, def := range defs {
+		t.fields[name] = def.dataType
 	}
 	t.mapToStruct()
-	return nil
 }
 func (t *Table) mapToStruct() {
 	var structFields []reflect.StructField
 
-	for k, v := range t.fields {
+	// Sorted so that identical fields build identical types.
+	names := make([]string, 0, len(t.fields))
+	for k := range t.fields {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		v := t.fields[k]
 		sf := reflect.StructField{
 			Name: title.String(k),
 		}
@@ -120,27 +154,30 @@ func (t *Table) mapToStruct() {
 func (t *Table) getInstance() reflect.Value {
 	return reflect.New(t.structType)
 }
-func (t *Table) setValues(s reflect.Value, row Data) reflect.Value {
+func (t *Table) setValues(s reflect.Value, row Data) (reflect.Value, error) {
 	for k, v := range row {
-		d := t.fields[lower.String(k)]
-		fv := s.Elem().FieldByName(title.String(k))
-		switch d {
-		case datatype.String:
-			fv.SetString(v.(string))
-		case datatype.Int:
-			switch x := v.(type) {
-			case float64: // json unmarshalling of int into an interface{}
-				fv.SetInt(int64(x))
-			case int:
-				fv.SetInt(int64(x))
-			}
-		case datatype.Bool:
-			fv.SetBool(v.(bool))
-		default:
-			fmt.Printf("%s\n", v)
+		d, ok := t.fields[lower.String(k)]
+		if !ok {
+			return s, fmt.Errorf("unknown field: %s", k)
+		}
+		value, err := d.Coerce(v)
+		if err != nil {
+			return s, fmt.Errorf("field %s: %w", k, err)
 		}
+		s.Elem().FieldByName(title.String(k)).Set(reflect.ValueOf(value))
+	}
+	return s, nil
+}
+func (t *Table) value(obj interface{}, field string) interface{} {
+	v := reflect.ValueOf(obj)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
 	}
-	return s
+	fv := v.FieldByName(title.String(field))
+	if !fv.IsValid() {
+		return nil
+	}
+	return fv.Interface()
 }
 func (t *Table) toMap(s interface{}) map[string]interface{} {
 	modelReflect := reflect.ValueOf(s)
@@ -168,6 +205,13 @@ func (t *Table) toMap(s interface{}) map[string]interface{} {
 	}
 	return m
 }
+func (t *Table) toData(obj interface{}) Data {
+	row := make(Data, len(t.fields))
+	for name := range t.fields {
+		row[name] = t.value(obj, name)
+	}
+	return row
+}
 func (t *Table) Fields() Fields {
 	return t.fields
 }
@@ -196,57 +240,459 @@ func (f Fields) Indexer(index *Index) memdb.Indexer {
 	return nil
 }
 
-func (s *Store) Select(query *Query, args map[string]string) ([]byte, error) {
-	// Create read-only transaction
-	txn := s.DB.Txn(false)
-	defer txn.Abort()
+func (s *Store) entity(name string) (*Entity, error) {
+	entity, ok := s.Entities[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown entity: %s", name)
+	}
+	return entity, nil
+}
+
+// index returns the declared index with the given (case-insensitive) name.
+func (e *Entity) index(name string) *Index {
+	for key, index := range e.Indexes {
+		if lower.String(key) == lower.String(name) {
+			return index
+		}
+	}
+	return nil
+}
 
+// indexField returns the field used for the position'th value of an index.
+func (e *Entity) indexField(index *Index, position int) string {
+	if position < len(index.Fields) {
+		return index.Fields[position]
+	} else if index.Field != "" {
+		return index.Field
+	}
+	return index.name
+}
+
+func (e *Entity) coerce(field string, value interface{}) (interface{}, error) {
+	d, ok := e.Table.fields[lower.String(field)]
+	if !ok {
+		return value, nil
+	}
+	v, err := d.Coerce(value)
+	if err != nil {
+		return nil, statusErrorf(http.StatusBadRequest, "field %s: %v", field, err)
+	}
+	return v, nil
+}
+
+// ownerValue returns the caller's value for the entity's owner field, or nil
+// when the entity is not scoped to its owner.
+func (e *Entity) ownerValue(req *handlers.Request) (interface{}, error) {
+	if e.Owner == nil {
+		return nil, nil
+	}
+	claim, ok := req.Lookup(fmt.Sprintf("%s.%s", handlers.AttrUser, e.Owner.Claim))
+	if !ok {
+		return nil, statusErrorf(http.StatusForbidden, "missing claim: %s", e.Owner.Claim)
+	}
+	return e.coerce(e.Owner.Field, claim)
+}
+
+func (e *Entity) key(obj interface{}) interface{} {
+	index := e.index("id")
+	if index == nil {
+		return nil
+	}
+	return e.Table.value(obj, e.indexField(index, 0))
+}
+
+// scan returns the index, and the values to look up in it, used to fetch the
+// candidate rows for a query.
+func (e *Entity) scan(query *Query, req *handlers.Request, opts *listOptions) (string, []interface{}, error) {
 	filter := "id"
 	values := make([]interface{}, 0)
 
 	if query.Filter != nil {
 		if query.Filter.Index != nil {
-			filter = *query.Filter.Index
+			filter = lower.String(*query.Filter.Index)
 		}
-		for _, name := range query.Filter.Fields {
-			if value, ok := args[name]; ok {
-				name = value
+		index := e.index(filter)
+		for position, name := range query.Filter.Fields {
+			value, err := resolve(name, req)
+			if err != nil {
+				return "", nil, err
+			}
+			if index != nil {
+				if value, err = e.coerce(e.indexField(index, position), value); err != nil {
+					return "", nil, err
+				}
 			}
-			values = append(values, name)
+			values = append(values, value)
+		}
+	} else if opts != nil {
+		if index, indexValues, ok := opts.plan(e); ok {
+			filter, values = index, indexValues
 		}
+	}
+	return filter, values, nil
+}
 
+// find returns the objects matching the query filter and any query string
+// options, restricted to those owned by the caller when the entity declares an
+// owner.
+func (s *Store) find(txn *memdb.Txn, query *Query, req *handlers.Request, opts *listOptions) ([]interface{}, error) {
+	entity, err := s.entity(query.Entity)
+	if err != nil {
+		return nil, err
 	}
 
-	// List all entries
-	it, err := txn.Get(query.Entity, filter, values...)
+	filter, values, err := entity.scan(query, req, opts)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
-	var bs []byte
-	result := make([]json.RawMessage, 0, 0)
-	for obj := it.Next(); obj != nil; obj = it.Next() {
-		bs, err = json.Marshal(obj)
+	owner, err := entity.ownerValue(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// A unique index lookup cannot match more than one row
+	if index := entity.index(filter); index != nil && index.Unique && len(values) > 0 && opts == nil {
+		obj, err := txn.First(query.Entity, filter, values...)
 		if err != nil {
 			return nil, err
 		}
-		result = append(result, bs)
+		if obj == nil || (owner != nil && entity.Table.value(obj, entity.Owner.Field) != owner) {
+			return []interface{}{}, nil
+		}
+		return []interface{}{obj}, nil
 	}
-	bs, err = json.Marshal(result)
+
+	it, err := txn.Get(query.Entity, filter, values...)
 	if err != nil {
 		return nil, err
 	}
-	return bs, nil
+
+	rows := make([]interface{}, 0)
+	for obj := it.Next(); obj != nil; obj = it.Next() {
+		if owner != nil && entity.Table.value(obj, entity.Owner.Field) != owner {
+			continue
+		}
+		if opts != nil && !opts.matches(entity, obj) {
+			continue
+		}
+		rows = append(rows, obj)
+	}
+	return rows, nil
+}
+
+// one reduces the rows of a single result query to its only row, reporting a
+// miss or an unexpected number of matches as configured on the query.
+func (q *Query) one(rows []interface{}) (interface{}, error) {
+	switch {
+	case len(rows) == 0:
+		return nil, q.failure(q.NotFound, http.StatusNotFound, "%s not found", q.Entity)
+	case len(rows) > 1:
+		return nil, q.failure(q.Multiple, http.StatusConflict, "%s query matched %d rows, expected one", q.Entity, len(rows))
+	}
+	return rows[0], nil
+}
+
+func (q *Query) failure(response *ErrorResponse, status int, format string, a ...interface{}) error {
+	err := &StatusError{Status: status, Message: fmt.Sprintf(format, a...), Response: response}
+	if response != nil && response.Status != 0 {
+		err.Status = response.Status
+	}
+	return err
+}
+
+// Select returns the rows matching the query as json, along with the entity
+// tag of a single result.
+func (s *Store) Select(query *Query, req *handlers.Request) ([]byte, string, error) {
+	// Create read-only transaction
+	txn := s.DB.Txn(false)
+	defer txn.Abort()
+
+	entity, err := s.entity(query.Entity)
+	if err != nil {
+		return nil, "", err
+	}
+	var opts *listOptions
+	if query.QueryParams || query.ExpandParam || query.Rsql != "" {
+		if opts, err = entity.parseParams(query, req); err != nil {
+			return nil, "", err
+		}
+	}
+
+	rows, err := s.find(txn, query, req, opts)
+	if err != nil {
+		return nil, "", err
+	}
+	out := rows
+	expand := query.Expand
+	if opts != nil {
+		opts.sortRows(entity, rows)
+		out = opts.project(entity, rows)
+		expand = append(expand[:len(expand):len(expand)], opts.expand...)
+	}
+	if out, err = s.expand(txn, query.Entity, expand, req, rows, out); err != nil {
+		return nil, "", err
+	}
+	if query.Single {
+		row, err := query.one(out)
+		if err != nil {
+			return nil, "", err
+		}
+		bs, err := json.Marshal(row)
+		if err != nil {
+			return nil, "", err
+		}
+		// Expanded or projected rows are tagged by what is sent, so that
+		// they change with their related rows and differ from the row's tag.
+		if len(expand) > 0 || (opts != nil && len(opts.fields) > 0) {
+			return bs, contentTag(bs), nil
+		}
+		return bs, entity.etag(rows[0]), nil
+	}
+	bs, err := json.Marshal(out)
+	return bs, "", err
 }
 
-func (s *Store) Insert() int {
-	return 0
+// Insert adds the json object, or array of objects, in body to the query's
+// entity. Query values, which may reference request attributes, and the
+// caller's owner claim override any supplied in the body. The entity tag of a
+// single object is returned with it.
+func (s *Store) Insert(query *Query, req *handlers.Request, body []byte) ([]byte, string, error) {
+	entity, err := s.entity(query.Entity)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var rows []Data
+	single := false
+	trimmed := strings.TrimSpace(string(body))
+	if strings.HasPrefix(trimmed, "[") {
+		err = json.Unmarshal(body, &rows)
+	} else {
+		row := Data{}
+		err = json.Unmarshal(body, &row)
+		rows, single = []Data{row}, true
+	}
+	if err != nil {
+		return nil, "", statusErrorf(http.StatusBadRequest, "invalid request body: %v", err)
+	}
+
+	owner, err := entity.ownerValue(req)
+	if err != nil {
+		return nil, "", err
+	}
+
+	txn := s.DB.Txn(true)
+	defer txn.Abort()
+
+	inserted := make([]interface{}, 0, len(rows))
+	var violations []string
+	for i, row := range rows {
+		row = lowerKeys(row)
+		for field, value := range query.Values {
+			if row[lower.String(field)], err = resolve(value, req); err != nil {
+				return nil, "", err
+			}
+		}
+		if owner != nil {
+			row[lower.String(entity.Owner.Field)] = owner
+		}
+		if entity.Version != "" {
+			delete(row, entity.Version)
+		}
+		obj, broken, err := entity.build(txn, query.Entity, row, nil)
+		if err != nil {
+			return nil, "", err
+		}
+		if len(broken) > 0 {
+			for _, violation := range broken {
+				if !single {
+					violation = fmt.Sprintf("row %d: %s", i+1, violation)
+				}
+				violations = append(violations, violation)
+			}
+			continue
+		}
+		if key := entity.key(obj); key != nil {
+			existing, err := txn.First(query.Entity, "id", key)
+			if err != nil {
+				return nil, "", err
+			}
+			if existing != nil {
+				return nil, "", statusErrorf(http.StatusConflict, "%s %v already exists", query.Entity, key)
+			}
+		}
+		if err = txn.Insert(query.Entity, obj); err != nil {
+			return nil, "", err
+		}
+		inserted = append(inserted, obj)
+	}
+	if len(violations) > 0 {
+		return nil, "", invalid(violations)
+	}
+	if err = s.checkReferences(txn, query.Entity, inserted); err != nil {
+		return nil, "", err
+	}
+	if err = s.record(changePut, query.Entity, inserted...); err != nil {
+		return nil, "", err
+	}
+	txn.Commit()
+
+	if single {
+		bs, err := json.Marshal(inserted[0])
+		return bs, entity.etag(inserted[0]), err
+	}
+	bs, err := json.Marshal(inserted)
+	return bs, "", err
 }
 
-func (s *Store) DeleteOne() int {
-	return 0
+// Update rewrites the rows matching the query with the json object in body.
+// The replace action builds each row from the body alone, while the patch
+// actions apply the body to the stored row. Key and owner fields cannot be
+// changed, and nothing is changed unless every row matches any If-Match
+// header.
+func (s *Store) Update(query *Query, req *handlers.Request, body []byte, action string) ([]byte, string, error) {
+	entity, err := s.entity(query.Entity)
+	if err != nil {
+		return nil, "", err
+	}
+	patch, err := entity.patcher(action, body)
+	if err != nil {
+		return nil, "", err
+	}
+
+	txn := s.DB.Txn(true)
+	defer txn.Abort()
+
+	rows, err := s.find(txn, query, req, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	if err = entity.precondition(req, rows); err != nil {
+		return nil, "", err
+	}
+	if len(rows) == 0 {
+		return nil, "", statusErrorf(http.StatusNotFound, "%s not found", query.Entity)
+	}
+
+	updated := make([]interface{}, 0, len(rows))
+	for _, obj := range rows {
+		existing := entity.Table.toData(obj)
+		row := Data{}
+		if action != ActionReplace {
+			row = entity.Table.toData(obj)
+		}
+		if err = patch(row); err != nil {
+			return nil, "", err
+		}
+		for field, value := range query.Values {
+			if row[lower.String(field)], err = resolve(value, req); err != nil {
+				return nil, "", err
+			}
+		}
+		entity.preserve(query, row, existing)
+		if action == ActionMergePatch || action == ActionJSONPatch {
+			if violations := entity.Table.typeCheck(row); len(violations) > 0 {
+				return nil, "", invalid(violations)
+			}
+		}
+
+		obj, violations, err := entity.build(txn, query.Entity, row, existing)
+		if err != nil {
+			return nil, "", err
+		}
+		if len(violations) > 0 {
+			return nil, "", invalid(violations)
+		}
+		if err = txn.Insert(query.Entity, obj); err != nil {
+			return nil, "", err
+		}
+		updated = append(updated, obj)
+	}
+	if err = s.checkReferences(txn, query.Entity, updated); err != nil {
+		return nil, "", err
+	}
+	if err = s.record(changePut, query.Entity, updated...); err != nil {
+		return nil, "", err
+	}
+	txn.Commit()
+
+	if len(updated) == 1 {
+		bs, err := json.Marshal(updated[0])
+		return bs, entity.etag(updated[0]), err
+	}
+	bs, err := json.Marshal(updated)
+	return bs, "", err
+}
+
+// preserve restores the key and owner fields of an existing row into row,
+// along with the fields of the index that the query finds it by, such as a
+// resource's key.
+func (e *Entity) preserve(query *Query, row, existing Data) {
+	if index := e.index("id"); index != nil {
+		field := lower.String(e.indexField(index, 0))
+		row[field] = existing[field]
+	}
+	if query.Filter != nil && query.Filter.Index != nil {
+		if index := e.index(*query.Filter.Index); index != nil {
+			for position := range query.Filter.Fields {
+				field := lower.String(e.indexField(index, position))
+				row[field] = existing[field]
+			}
+		}
+	}
+	if e.Owner != nil {
+		field := lower.String(e.Owner.Field)
+		row[field] = existing[field]
+	}
 }
 
-func (s *Store) DeleteAll() int {
-	return 0
+// Delete removes the rows matching the query and returns how many were removed.
+func (s *Store) Delete(query *Query, req *handlers.Request) (int, error) {
+	entity, err := s.entity(query.Entity)
+	if err != nil {
+		return 0, err
+	}
+	txn := s.DB.Txn(true)
+	defer txn.Abort()
+
+	rows, err := s.find(txn, query, req, nil)
+	if err != nil {
+		return 0, err
+	}
+	if err = entity.precondition(req, rows); err != nil {
+		return 0, err
+	}
+	if query.Single {
+		if _, err = query.one(rows); err != nil {
+			return 0, err
+		}
+	}
+	if err = s.remove(txn, query.Entity, rows); err != nil {
+		return 0, err
+	}
+	txn.Commit()
+	return len(rows), nil
+}
+
+// Rows returns the number of rows held for each entity.
+func (s *Store) Rows() map[string]int {
+	rows := make(map[string]int, len(s.Entities))
+	if s.DB == nil {
+		return rows
+	}
+	txn := s.DB.Txn(false)
+	defer txn.Abort()
+	for name := range s.Entities {
+		it, err := txn.Get(name, "id")
+		if err != nil {
+			continue
+		}
+		count := 0
+		for obj := it.Next(); obj != nil; obj = it.Next() {
+			count++
+		}
+		rows[name] = count
+	}
+	return rows
 }
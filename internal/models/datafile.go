@@ -0,0 +1,261 @@
+package models
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/go-memdb"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+	FormatJSON   = "json"
+	FormatYAML   = "yaml"
+)
+
+var formatExtensions = map[string]string{
+	".csv":    FormatCSV,
+	".ndjson": FormatNDJSON,
+	".jsonl":  FormatNDJSON,
+	".json":   FormatJSON,
+	".yaml":   FormatYAML,
+	".yml":    FormatYAML,
+}
+
+// DataFile seeds an entity from a file, given either as just its name or as
+// a mapping. The format is taken from the file extension unless set. The
+// first line of a csv file names the field of each column, or the column is
+// renamed through Columns; columns mapped to - are skipped, as are empty
+// cells, and values are converted to the field's data type.
+type DataFile struct {
+	File    string            `json:"file" yaml:"file"`
+	Format  string            `json:"format,omitempty" yaml:"format,omitempty"`
+	Columns map[string]string `json:"columns,omitempty" yaml:"columns,omitempty"`
+	rows    []Data
+}
+
+type dataFile DataFile
+
+func (f *DataFile) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*f = DataFile{File: value.Value}
+		return nil
+	}
+	return value.Decode((*dataFile)(f))
+}
+
+func (f *DataFile) UnmarshalJSON(data []byte) error {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte(`"`)) {
+		*f = DataFile{}
+		return json.Unmarshal(data, &f.File)
+	}
+	return json.Unmarshal(data, (*dataFile)(f))
+}
+
+// Load reads the rows of the file, relative to dir, and returns its name.
+func (f *DataFile) Load(dir string) (string, error) {
+	filename := f.File
+	if !filepath.IsAbs(filename) {
+		filename = filepath.Join(dir, filename)
+	}
+	format := f.Format
+	if format == "" {
+		format = formatExtensions[lower.String(filepath.Ext(filename))]
+	}
+	bs, err := os.ReadFile(filename)
+	if err != nil {
+		return "", fmt.Errorf("unable to read data file %s: %w", f.File, err)
+	}
+
+	switch lower.String(format) {
+	case FormatCSV:
+		f.rows, err = f.readCSV(bs)
+	case FormatNDJSON:
+		f.rows, err = readNDJSON(bs)
+	case FormatJSON:
+		f.rows = nil
+		err = json.Unmarshal(bs, &f.rows)
+	case FormatYAML:
+		f.rows = nil
+		err = yaml.Unmarshal(bs, &f.rows)
+	default:
+		return "", fmt.Errorf("data file %s: unknown format %q", f.File, format)
+	}
+	if err != nil {
+		return "", fmt.Errorf("data file %s: %w", f.File, err)
+	}
+	return filename, nil
+}
+
+func (f *DataFile) readCSV(bs []byte) ([]Data, error) {
+	r := csv.NewReader(bytes.NewReader(bs))
+	r.TrimLeadingSpace = true
+	header, err := r.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	fields := make([]string, len(header))
+	for i, column := range header {
+		column = strings.TrimSpace(strings.TrimPrefix(column, "\ufeff"))
+		fields[i] = column
+		for from, to := range f.Columns {
+			if strings.EqualFold(from, column) {
+				fields[i] = to
+			}
+		}
+	}
+
+	var rows []Data
+	for {
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		} else if err != nil {
+			return nil, err
+		}
+		row := Data{}
+		for i, value := range record {
+			if fields[i] == "-" || fields[i] == "" || value == "" {
+				continue
+			}
+			row[fields[i]] = value
+		}
+		rows = append(rows, row)
+	}
+}
+
+func readNDJSON(bs []byte) ([]Data, error) {
+	var rows []Data
+	scanner := bufio.NewScanner(bytes.NewReader(bs))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		row := Data{}
+		if err := json.Unmarshal(text, &row); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		rows = append(rows, row)
+	}
+	return rows, scanner.Err()
+}
+
+// seedRows returns the rows that seed an entity: those of the source data,
+// then those of its data file and finally any it generates.
+func (s *Store) seedRows(name string) ([]Data, error) {
+	rows := s.Data[name]
+	entity := s.Entities[name]
+	if entity == nil {
+		return rows, nil
+	}
+	if entity.DataFile != nil {
+		rows = append(rows[:len(rows):len(rows)], entity.DataFile.rows...)
+	}
+	generated, err := entity.generated(name, rows)
+	if err != nil {
+		return nil, err
+	}
+	return append(rows[:len(rows):len(rows)], generated...), nil
+}
+
+func (s *Store) seeded() bool {
+	for name, entity := range s.Entities {
+		if len(s.Data[name]) > 0 || entity.DataFile != nil || entity.Generate != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Store) seed(txn *memdb.Txn, name string) error {
+	rows, err := s.seedRows(name)
+	if err != nil {
+		return err
+	}
+	entity := s.Entities[name]
+	for _, row := range rows {
+		obj, violations, err := entity.build(txn, name, lowerKeys(row), nil)
+		if err != nil {
+			return fmt.Errorf("invalid %s data: %w", name, err)
+		}
+		if len(violations) > 0 {
+			return fmt.Errorf("invalid %s data: %s", name, strings.Join(violations, "; "))
+		}
+		if err = txn.Insert(name, obj); err != nil {
+			return fmt.Errorf("invalid %s data: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// reseeds returns the entities, carried over from the previous store, whose
+// seed data has changed.
+func (s *Store) reseeds(previous *Store) ([]string, error) {
+	var names []string
+	for _, name := range sortedNames(s.Entities) {
+		if _, ok := previous.Entities[name]; !ok {
+			continue
+		}
+		changed, err := s.seedChanged(previous, name)
+		if err != nil {
+			return nil, err
+		}
+		if changed {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// reseed replaces the rows of the named entities with their seed data.
+func (s *Store) reseed(names []string) error {
+	if len(names) == 0 {
+		return nil
+	}
+	txn := s.DB.Txn(true)
+	defer txn.Abort()
+	for _, name := range names {
+		if _, err := txn.DeleteAll(name, "id"); err != nil {
+			return err
+		}
+		if err := s.seed(txn, name); err != nil {
+			return err
+		}
+	}
+	txn.Commit()
+	s.replaced()
+	return nil
+}
+
+func (s *Store) seedChanged(previous *Store, name string) (bool, error) {
+	rows, err := s.seedRows(name)
+	if err != nil {
+		return false, err
+	}
+	current, err := json.Marshal(rows)
+	if err != nil {
+		return false, err
+	}
+	if rows, err = previous.seedRows(name); err != nil {
+		return false, err
+	}
+	before, err := json.Marshal(rows)
+	if err != nil {
+		return false, err
+	}
+	return !bytes.Equal(current, before), nil
+}
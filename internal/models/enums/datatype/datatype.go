@@ -2,6 +2,7 @@ package datatype
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 )
 
@@ -25,15 +26,73 @@ func (d DataType) EnumIndex() int {
 	return int(d)
 }
 
+// DataTypeOf is Parse for names known to be valid, panicking otherwise.
 func DataTypeOf(value string) DataType {
+	d, err := Parse(value)
+	if err != nil {
+		panic(err.Error())
+	}
+	return d
+}
+
+// Parse returns the data type named by value, ignoring case.
+func Parse(value string) (DataType, error) {
 	switch strings.ToLower(value) {
 	case "string":
-		return String
+		return String, nil
 	case "int":
-		return Int
+		return Int, nil
 	case "bool":
-		return Bool
+		return Bool, nil
 	}
+	return 0, fmt.Errorf("unknown type: %s", value)
+}
 
-	panic(fmt.Sprintf("unknown value: %s", value))
+// Coerce converts a value decoded from json, yaml or a url into the Go type
+// used to store the data type: string, int64 or bool.
+func (d DataType) Coerce(value interface{}) (interface{}, error) {
+	switch d {
+	case String:
+		switch v := value.(type) {
+		case string:
+			return v, nil
+		case nil:
+			return "", nil
+		case map[string]interface{}, []interface{}:
+			return nil, fmt.Errorf("cannot use %v as a String", value)
+		}
+		return fmt.Sprint(value), nil
+	case Int:
+		switch v := value.(type) {
+		case int:
+			return int64(v), nil
+		case int64:
+			return v, nil
+		case int32:
+			return int64(v), nil
+		case float64:
+			if v != float64(int64(v)) {
+				return nil, fmt.Errorf("cannot use %v as an Int", value)
+			}
+			return int64(v), nil
+		case string:
+			i, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("cannot use %q as an Int", v)
+			}
+			return i, nil
+		}
+	case Bool:
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case string:
+			b, err := strconv.ParseBool(strings.TrimSpace(v))
+			if err != nil {
+				return nil, fmt.Errorf("cannot use %q as a Bool", v)
+			}
+			return b, nil
+		}
+	}
+	return nil, fmt.Errorf("cannot use %v as a %s", value, d)
 }
@@ -0,0 +1,72 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"jrest/internal/handlers"
+	"jrest/internal/models/enums/datatype"
+	"net/http"
+)
+
+// checkVersion ensures that an entity's version field is an Int.
+func (e *Entity) checkVersion(name string) error {
+	if e.Version == "" {
+		return nil
+	}
+	e.Version = lower.String(e.Version)
+	if d, ok := e.Table.fields[e.Version]; !ok || d != datatype.Int {
+		return fmt.Errorf("entity %s: version field %q must be an Int", name, e.Version)
+	}
+	return nil
+}
+
+// version sets the version of a row about to be written: one for a new row
+// that does not carry one, and one more than existing's otherwise.
+func (e *Entity) version(row, existing Data) {
+	if e.Version == "" {
+		return
+	}
+	if existing != nil {
+		current, _ := datatype.Int.Coerce(existing[e.Version])
+		v, _ := current.(int64)
+		row[e.Version] = v + 1
+		return
+	}
+	if v, err := datatype.Int.Coerce(row[e.Version]); err != nil || isZero(v) {
+		row[e.Version] = int64(1)
+	}
+}
+
+// etag returns the entity tag of a stored row: its version when the entity
+// keeps one, otherwise a hash of its content.
+func (e *Entity) etag(obj interface{}) string {
+	if e.Version != "" {
+		return fmt.Sprintf(`"%d"`, e.Table.value(obj, e.Version))
+	}
+	bs, _ := json.Marshal(obj)
+	return contentTag(bs)
+}
+
+// contentTag returns an entity tag for a response body.
+func contentTag(bs []byte) string {
+	sum := sha256.Sum256(bs)
+	return fmt.Sprintf(`"%x"`, sum[:8])
+}
+
+// precondition checks the rows about to be changed against the request's
+// If-Match header.
+func (e *Entity) precondition(req *handlers.Request, rows []interface{}) error {
+	if req.IfMatch == "" {
+		return nil
+	}
+	if len(rows) == 0 {
+		return statusErrorf(http.StatusPreconditionFailed, "precondition failed")
+	}
+	for _, obj := range rows {
+		if !handlers.MatchETag(req.IfMatch, e.etag(obj), false) {
+			return statusErrorf(http.StatusPreconditionFailed, "precondition failed")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,268 @@
+package models
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"jrest/internal/models/enums/datatype"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/hashicorp/go-memdb"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	GeneratedAutoIncrement = "auto_increment"
+	GeneratedUUID          = "uuid"
+	GeneratedCreated       = "created"
+	GeneratedUpdated       = "updated"
+)
+
+// Field defines a field of an entity, given either as just its type or as a
+// mapping that also constrains its values:
+//
+//	name:   {type: String, required: true, max: 40}
+//	status: {type: String, enum: [open, closed], default: open}
+//	id:     {type: Int, generated: auto_increment}
+//
+// Min and Max bound an Int's value and a String's length. Generated fields
+// are filled when a row is created without them: auto_increment numbers on
+// from the largest stored value, uuid assigns a random uuid and created the
+// current time. Updated is set to the current time on every write. Generated
+// values, apart from updated, are kept when a row is replaced or patched.
+type Field struct {
+	Type      string        `json:"type" yaml:"type"`
+	Required  bool          `json:"required,omitempty" yaml:"required,omitempty"`
+	Default   interface{}   `json:"default,omitempty" yaml:"default,omitempty"`
+	Min       *int64        `json:"min,omitempty" yaml:"min,omitempty"`
+	Max       *int64        `json:"max,omitempty" yaml:"max,omitempty"`
+	Pattern   string        `json:"pattern,omitempty" yaml:"pattern,omitempty"`
+	Enum      []interface{} `json:"enum,omitempty" yaml:"enum,omitempty"`
+	Generated string        `json:"generated,omitempty" yaml:"generated,omitempty"`
+	dataType  datatype.DataType
+	pattern   *regexp.Regexp
+}
+
+type field Field
+
+func (f *Field) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*f = Field{Type: value.Value}
+	} else if err := value.Decode((*field)(f)); err != nil {
+		return err
+	}
+	return f.resolve()
+}
+
+func (f *Field) UnmarshalJSON(data []byte) error {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte(`"`)) {
+		*f = Field{}
+		if err := json.Unmarshal(data, &f.Type); err != nil {
+			return err
+		}
+	} else if err := json.Unmarshal(data, (*field)(f)); err != nil {
+		return err
+	}
+	return f.resolve()
+}
+
+func (f *Field) resolve() error {
+	if f.Type == "" {
+		return errors.New("missing type")
+	}
+	var err error
+	if f.dataType, err = datatype.Parse(f.Type); err != nil {
+		return err
+	}
+	if f.Pattern != "" {
+		if f.pattern, err = regexp.Compile(f.Pattern); err != nil {
+			return fmt.Errorf("pattern: %w", err)
+		}
+	}
+	if f.Default != nil {
+		if f.Default, err = f.dataType.Coerce(f.Default); err != nil {
+			return fmt.Errorf("default: %w", err)
+		}
+	}
+	for i, value := range f.Enum {
+		if f.Enum[i], err = f.dataType.Coerce(value); err != nil {
+			return fmt.Errorf("enum: %w", err)
+		}
+	}
+	switch f.Generated {
+	case "":
+	case GeneratedAutoIncrement:
+		if f.dataType != datatype.Int {
+			return fmt.Errorf("%s requires an Int", f.Generated)
+		}
+	case GeneratedUUID:
+		if f.dataType != datatype.String {
+			return fmt.Errorf("%s requires a String", f.Generated)
+		}
+	case GeneratedCreated, GeneratedUpdated:
+		if f.dataType == datatype.Bool {
+			return fmt.Errorf("%s requires a String or an Int", f.Generated)
+		}
+	default:
+		return fmt.Errorf("unknown generated value %q", f.Generated)
+	}
+	return nil
+}
+
+// timestamp returns t as stored by the field: seconds since the epoch for an
+// Int, RFC 3339 otherwise.
+func (f *Field) timestamp(t time.Time) interface{} {
+	if f.dataType == datatype.Int {
+		return t.Unix()
+	}
+	return t.Format(time.RFC3339)
+}
+
+// check returns the constraints a field's value breaks. present reports
+// whether the row supplied the field at all.
+func (f *Field) check(name string, value interface{}, present bool) []string {
+	if !present || value == "" {
+		if f.Required {
+			return []string{fmt.Sprintf("%s is required", name)}
+		}
+		return nil
+	}
+
+	var violations []string
+	size, unit := int64(0), ""
+	switch v := value.(type) {
+	case int64:
+		size = v
+	case string:
+		size, unit = int64(utf8.RuneCountInString(v)), " characters long"
+	}
+	if f.Min != nil && size < *f.Min {
+		violations = append(violations, fmt.Sprintf("%s must be at least %d%s", name, *f.Min, unit))
+	}
+	if f.Max != nil && size > *f.Max {
+		violations = append(violations, fmt.Sprintf("%s must be at most %d%s", name, *f.Max, unit))
+	}
+	if f.pattern != nil && !f.pattern.MatchString(fmt.Sprint(value)) {
+		violations = append(violations, fmt.Sprintf("%s must match %s", name, f.Pattern))
+	}
+	if len(f.Enum) > 0 {
+		found := false
+		for _, allowed := range f.Enum {
+			if allowed == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			values := make([]string, len(f.Enum))
+			for i, allowed := range f.Enum {
+				values[i] = fmt.Sprint(allowed)
+			}
+			violations = append(violations, fmt.Sprintf("%s must be one of %s", name, strings.Join(values, ", ")))
+		}
+	}
+	return violations
+}
+
+// complete fills in the generated and default values of a row about to be
+// written. existing is the stored row being replaced, if any.
+func (e *Entity) complete(txn *memdb.Txn, name string, row, existing Data) error {
+	e.version(row, existing)
+	now := time.Now().UTC()
+	for _, field := range sortedNames(e.Table.defs) {
+		def := e.Table.defs[field]
+		if def.Generated == GeneratedUpdated && (existing != nil || row[field] == nil) {
+			row[field] = def.timestamp(now)
+			continue
+		}
+		if def.Generated != "" && existing != nil {
+			row[field] = existing[field]
+			continue
+		}
+		if value, ok := row[field]; ok && value != nil {
+			if def.Generated != GeneratedAutoIncrement {
+				continue
+			}
+			if v, err := def.dataType.Coerce(value); err != nil || !isZero(v) {
+				continue
+			}
+		}
+
+		switch def.Generated {
+		case GeneratedAutoIncrement:
+			next, err := e.next(txn, name, field)
+			if err != nil {
+				return err
+			}
+			row[field] = next
+		case GeneratedUUID:
+			b := make([]byte, 16)
+			if _, err := rand.Read(b); err != nil {
+				return err
+			}
+			row[field] = formatUUID(b)
+		case GeneratedCreated:
+			row[field] = def.timestamp(now)
+		default:
+			if def.Default != nil {
+				row[field] = def.Default
+			}
+		}
+	}
+	return nil
+}
+
+// next returns one more than the largest value stored in an Int field.
+func (e *Entity) next(txn *memdb.Txn, name, field string) (int64, error) {
+	it, err := txn.Get(name, "id")
+	if err != nil {
+		return 0, err
+	}
+	next := int64(1)
+	for obj := it.Next(); obj != nil; obj = it.Next() {
+		if v, ok := e.Table.value(obj, field).(int64); ok && v >= next {
+			next = v + 1
+		}
+	}
+	return next, nil
+}
+
+// build completes a row and converts it to a stored object, returning the
+// constraints it breaks rather than the object if any.
+func (e *Entity) build(txn *memdb.Txn, name string, row, existing Data) (interface{}, []string, error) {
+	if err := e.complete(txn, name, row, existing); err != nil {
+		return nil, nil, err
+	}
+	instance, err := e.Table.setValues(e.Table.getInstance(), row)
+	if err != nil {
+		return nil, nil, statusErrorf(http.StatusBadRequest, "%v", err)
+	}
+	obj := instance.Interface()
+
+	var violations []string
+	for _, field := range sortedNames(e.Table.defs) {
+		value, ok := row[field]
+		violations = append(violations, e.Table.defs[field].check(field, e.Table.value(obj, field), ok && value != nil)...)
+	}
+	if len(violations) > 0 {
+		return nil, violations, nil
+	}
+	return obj, nil, nil
+}
+
+// invalid reports the constraints broken by the rows of a write.
+func invalid(violations []string) error {
+	return statusErrorf(http.StatusUnprocessableEntity, "%s", strings.Join(violations, "\n"))
+}
+
+func formatUUID(b []byte) string {
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
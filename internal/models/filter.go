@@ -0,0 +1,171 @@
+package models
+
+import (
+	"jrest/internal/models/enums/datatype"
+	"jrest/internal/models/rsql"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+type predicate func(obj interface{}) bool
+
+// parseFilter parses and type checks an RSQL filter expression against the
+// entity's fields.
+func (e *Entity) parseFilter(expression string) (predicate, *indexHint, error) {
+	node, err := rsql.Parse(expression)
+	if err != nil {
+		return nil, nil, statusErrorf(http.StatusBadRequest, "invalid filter: %v", err)
+	}
+	match, err := e.compile(node)
+	if err != nil {
+		return nil, nil, statusErrorf(http.StatusBadRequest, "invalid filter: %v", err)
+	}
+	return match, e.planFilter(node), nil
+}
+
+func (e *Entity) compile(node rsql.Node) (predicate, error) {
+	switch n := node.(type) {
+	case *rsql.Logical:
+		children := make([]predicate, 0, len(n.Children))
+		for _, child := range n.Children {
+			match, err := e.compile(child)
+			if err != nil {
+				return nil, err
+			}
+			children = append(children, match)
+		}
+		if n.And {
+			return func(obj interface{}) bool {
+				for _, match := range children {
+					if !match(obj) {
+						return false
+					}
+				}
+				return true
+			}, nil
+		}
+		return func(obj interface{}) bool {
+			for _, match := range children {
+				if match(obj) {
+					return true
+				}
+			}
+			return false
+		}, nil
+	case *rsql.Comparison:
+		return e.compileComparison(n)
+	}
+	return nil, rsql.Errorf(node.Position(), "unsupported expression")
+}
+
+func (e *Entity) compileComparison(c *rsql.Comparison) (predicate, error) {
+	field := lower.String(c.Selector)
+	d, ok := e.Table.fields[field]
+	if !ok {
+		return nil, rsql.Errorf(c.Pos, "unknown field %s", c.Selector)
+	}
+
+	if (c.Operator == rsql.Equal || c.Operator == rsql.NotEqual) && c.Wildcard(0) {
+		if d != datatype.String {
+			return nil, rsql.Errorf(c.Pos, "wildcards require a String field, %s is %s", c.Selector, d)
+		}
+		re := wildcard(c.Args[0])
+		negate := c.Operator == rsql.NotEqual
+		return func(obj interface{}) bool {
+			s, _ := e.Table.value(obj, field).(string)
+			return re.MatchString(s) != negate
+		}, nil
+	}
+
+	args := make([]interface{}, len(c.Args))
+	for i, arg := range c.Args {
+		value, err := d.Coerce(arg)
+		if err != nil {
+			return nil, rsql.Errorf(c.Pos, "field %s: %v", c.Selector, err)
+		}
+		args[i] = value
+	}
+
+	switch c.Operator {
+	case rsql.Equal, rsql.In:
+		return func(obj interface{}) bool {
+			return containsValue(args, e.Table.value(obj, field))
+		}, nil
+	case rsql.NotEqual, rsql.Out:
+		return func(obj interface{}) bool {
+			return !containsValue(args, e.Table.value(obj, field))
+		}, nil
+	}
+
+	if d == datatype.Bool {
+		return nil, rsql.Errorf(c.Pos, "operator %s is not supported for Bool field %s", c.Operator, c.Selector)
+	}
+	operator := c.Operator
+	return func(obj interface{}) bool {
+		cmp := compareValues(e.Table.value(obj, field), args[0])
+		switch operator {
+		case rsql.Greater:
+			return cmp > 0
+		case rsql.GreaterOrEqual:
+			return cmp >= 0
+		case rsql.Less:
+			return cmp < 0
+		case rsql.LessOrEqual:
+			return cmp <= 0
+		}
+		return false
+	}, nil
+}
+
+type indexHint struct {
+	index string
+	value interface{}
+}
+
+// planFilter finds an equality on an indexed field that every matching row must
+// satisfy, i.e. at the top level or within a top level and, so that the scan
+// can use the index rather than the whole table.
+func (e *Entity) planFilter(node rsql.Node) *indexHint {
+	candidates := []rsql.Node{node}
+	if l, ok := node.(*rsql.Logical); ok && l.And {
+		candidates = l.Children
+	}
+	for _, candidate := range candidates {
+		c, ok := candidate.(*rsql.Comparison)
+		if !ok || len(c.Args) != 1 || (c.Operator != rsql.Equal && c.Operator != rsql.In) {
+			continue
+		}
+		if c.Wildcard(0) {
+			continue
+		}
+		field := lower.String(c.Selector)
+		name, ok := e.fieldIndex(field)
+		if !ok {
+			continue
+		}
+		value, err := e.Table.fields[field].Coerce(c.Args[0])
+		if err != nil || !indexable(name, value) {
+			continue
+		}
+		return &indexHint{index: name, value: value}
+	}
+	return nil
+}
+
+func containsValue(values []interface{}, v interface{}) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+func wildcard(pattern string) *regexp.Regexp {
+	parts := strings.Split(pattern, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	return regexp.MustCompile("^" + strings.Join(parts, ".*") + "$")
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"net/url"
+	"testing"
+)
+
+const starredNames = `
+storage:
+  entities:
+    person:
+      fields: {id: Int, name: String}
+      indexes: {id: {field: id, unique: true}, name: {field: name}}
+  data:
+    person:
+      - {id: 1, name: "a*b"}
+      - {id: 2, name: axb}
+`
+
+func TestFilterQuotedWildcards(t *testing.T) {
+	store := testSource(t, starredNames).Storage
+	query := &Query{Entity: "person", Rsql: "q"}
+	tests := []struct {
+		filter string
+		want   []float64
+	}{
+		{`name==a*b`, []float64{1, 2}},
+		{`name=="a*b"`, []float64{1}},
+		{`name=='a*b'`, []float64{1}},
+		{`name!="a*b"`, []float64{2}},
+		{`name=in=("a*b",x)`, []float64{1}},
+		{`name==a*b;name=='axb'`, []float64{2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.filter, func(t *testing.T) {
+			rows := selectRows(t, store, query, "q="+url.QueryEscape(tt.filter))
+			if len(rows) != len(tt.want) {
+				t.Fatalf("got %v, want ids %v", rows, tt.want)
+			}
+			for i, row := range rows {
+				if row["Id"] != tt.want[i] {
+					t.Errorf("row %d id = %v, want %v", i, row["Id"], tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,355 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"regexp"
+	"time"
+
+	"jrest/internal/models/enums/datatype"
+
+	"github.com/hashicorp/go-memdb"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	GenerateSequence = "sequence"
+	GeneratePick     = "pick"
+	GenerateInt      = "int"
+	GenerateName     = "name"
+	GenerateEmail    = "email"
+	GenerateUUID     = "uuid"
+	GenerateDate     = "date"
+	GenerateTemplate = "template"
+
+	defaultDateFormat = "2006-01-02"
+	uniqueAttempts    = 100
+)
+
+var templateField = regexp.MustCompile(`\{([a-zA-Z0-9_]+)\}`)
+
+var (
+	firstNames = []string{
+		"Ada", "Alan", "Alice", "Ben", "Carla", "Chen", "Dana", "David", "Elena", "Emma",
+		"Farah", "George", "Grace", "Hugo", "Ines", "Ivan", "James", "Julia", "Kenji", "Laura",
+		"Liam", "Maria", "Mateo", "Nadia", "Noah", "Olivia", "Omar", "Priya", "Quinn", "Rosa",
+		"Sam", "Sofia", "Tom", "Uma", "Victor", "Wei", "Yara", "Zoe",
+	}
+	lastNames = []string{
+		"Adams", "Baker", "Brown", "Clark", "Davis", "Evans", "Garcia", "Hall", "Hughes", "Ito",
+		"Jones", "Khan", "Kim", "Lee", "Lopez", "Martin", "Miller", "Moore", "Nguyen", "Patel",
+		"Perez", "Quinn", "Reyes", "Rossi", "Smith", "Silva", "Taylor", "Turner", "Walker", "White",
+		"Wilson", "Wright", "Young",
+	}
+)
+
+// Generate seeds an entity with Count synthetic rows. The same Seed always
+// produces the same rows. Fields without a generator are left at their zero
+// value, except that the field of a single field unique index defaults to a
+// sequence after the largest seeded value if an Int, and to a uuid otherwise.
+// Generated values are retried until every unique index is satisfied; as in
+// the database, an index over several fields is keyed on the first of them.
+type Generate struct {
+	Count  int                   `json:"count" yaml:"count"`
+	Seed   int64                 `json:"seed,omitempty" yaml:"seed,omitempty"`
+	Fields map[string]*Generator `json:"fields,omitempty" yaml:"fields,omitempty"`
+	rows   []Data
+	done   bool
+}
+
+// Generator produces the values of a field, given either as just its type or
+// as a mapping:
+//
+//	sequence  start, step                 pick      values
+//	int       min, max (inclusive)        name, email, uuid
+//	date      from, to, format            template  e.g. "{name}-{id}"
+//
+// Dates are written with format, by default 2006-01-02, or as unix seconds
+// into Int fields. Templates are filled in after the other fields.
+type Generator struct {
+	Type     string        `json:"type" yaml:"type"`
+	Start    int64         `json:"start,omitempty" yaml:"start,omitempty"`
+	Step     int64         `json:"step,omitempty" yaml:"step,omitempty"`
+	Values   []interface{} `json:"values,omitempty" yaml:"values,omitempty"`
+	Min      int64         `json:"min,omitempty" yaml:"min,omitempty"`
+	Max      int64         `json:"max,omitempty" yaml:"max,omitempty"`
+	From     string        `json:"from,omitempty" yaml:"from,omitempty"`
+	To       string        `json:"to,omitempty" yaml:"to,omitempty"`
+	Format   string        `json:"format,omitempty" yaml:"format,omitempty"`
+	Template string        `json:"template,omitempty" yaml:"template,omitempty"`
+	from, to time.Time
+}
+
+type generator Generator
+
+func (g *Generator) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*g = Generator{Type: value.Value}
+		return nil
+	}
+	return value.Decode((*generator)(g))
+}
+
+func (g *Generator) UnmarshalJSON(data []byte) error {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte(`"`)) {
+		*g = Generator{}
+		return json.Unmarshal(data, &g.Type)
+	}
+	return json.Unmarshal(data, (*generator)(g))
+}
+
+func (g *Generator) validate() error {
+	switch g.Type {
+	case GenerateName, GenerateEmail, GenerateUUID:
+	case GenerateSequence:
+		if g.Step == 0 {
+			g.Step = 1
+		}
+	case GeneratePick:
+		if len(g.Values) == 0 {
+			return fmt.Errorf("pick requires values")
+		}
+	case GenerateInt:
+		if g.Max < g.Min {
+			return fmt.Errorf("int max %d is less than min %d", g.Max, g.Min)
+		}
+	case GenerateDate:
+		if g.Format == "" {
+			g.Format = defaultDateFormat
+		}
+		var err error
+		if g.from, err = time.Parse(g.Format, g.From); err != nil {
+			return fmt.Errorf("date from: %w", err)
+		}
+		if g.to, err = time.Parse(g.Format, g.To); err != nil {
+			return fmt.Errorf("date to: %w", err)
+		}
+		if g.to.Before(g.from) {
+			return fmt.Errorf("date to %s is before from %s", g.To, g.From)
+		}
+	case GenerateTemplate:
+		if g.Template == "" {
+			return fmt.Errorf("template requires a template")
+		}
+	default:
+		return fmt.Errorf("unknown generator: %s", g.Type)
+	}
+	return nil
+}
+
+func (g *Generator) value(rng *rand.Rand, position int, d datatype.DataType) interface{} {
+	switch g.Type {
+	case GenerateSequence:
+		return g.Start + int64(position)*g.Step
+	case GeneratePick:
+		return g.Values[rng.Intn(len(g.Values))]
+	case GenerateInt:
+		return g.Min + rng.Int63n(g.Max-g.Min+1)
+	case GenerateName:
+		return firstNames[rng.Intn(len(firstNames))] + " " + lastNames[rng.Intn(len(lastNames))]
+	case GenerateEmail:
+		return fmt.Sprintf("%s.%s%d@example.com",
+			lower.String(firstNames[rng.Intn(len(firstNames))]),
+			lower.String(lastNames[rng.Intn(len(lastNames))]),
+			rng.Intn(1000))
+	case GenerateUUID:
+		b := make([]byte, 16)
+		rng.Read(b)
+		return formatUUID(b)
+	case GenerateDate:
+		span := g.to.Unix() - g.from.Unix()
+		t := time.Unix(g.from.Unix()+rng.Int63n(span+1), 0).UTC()
+		if d == datatype.Int {
+			return t.Unix()
+		}
+		return t.Format(g.Format)
+	}
+	return nil
+}
+
+func fillTemplate(template string, row Data) string {
+	return templateField.ReplaceAllStringFunc(template, func(placeholder string) string {
+		if v, ok := row[lower.String(placeholder[1:len(placeholder)-1])]; ok {
+			return fmt.Sprint(v)
+		}
+		return placeholder
+	})
+}
+
+// generated returns the entity's synthetic rows, given the rows it is already
+// seeded with, building them on first use.
+func (e *Entity) generated(name string, seeded []Data) ([]Data, error) {
+	g := e.Generate
+	if g == nil || g.Count <= 0 {
+		return nil, nil
+	}
+	if g.done {
+		return g.rows, nil
+	}
+	rows, err := e.generate(seeded)
+	if err != nil {
+		return nil, fmt.Errorf("generating %s: %w", name, err)
+	}
+	g.rows, g.done = rows, true
+	return rows, nil
+}
+
+func (e *Entity) generate(seeded []Data) ([]Data, error) {
+	g := e.Generate
+	generators := make(map[string]*Generator, len(g.Fields))
+	for field, generator := range g.Fields {
+		field = lower.String(field)
+		if _, ok := e.Table.fields[field]; !ok {
+			return nil, fmt.Errorf("unknown field: %s", field)
+		}
+		if generator == nil {
+			return nil, fmt.Errorf("field %s has no generator", field)
+		}
+		if err := generator.validate(); err != nil {
+			return nil, fmt.Errorf("field %s: %w", field, err)
+		}
+		generators[field] = generator
+	}
+
+	// Unique indexes, checked through the indexers the database uses.
+	var uniques []*uniqueIndex
+	for _, key := range sortedNames(e.Indexes) {
+		index := e.Indexes[key]
+		if index == nil || !index.Unique {
+			continue
+		}
+		named := *index
+		named.name = key
+		indexer, ok := e.Table.fields.Indexer(&named).(memdb.SingleIndexer)
+		if !ok {
+			continue
+		}
+		field := lower.String(e.indexField(&named, 0))
+		uniques = append(uniques, &uniqueIndex{field: field, indexer: indexer, used: make(map[string]bool)})
+		if index.Field != "" || len(index.Fields) <= 1 {
+			if generators[field] == nil {
+				generators[field] = e.keyGenerator(field, seeded)
+			}
+		}
+	}
+	for _, row := range seeded {
+		// Seed rows that cannot be stored are reported when they are seeded.
+		if keys, err := e.uniqueKeys(lowerKeys(row), uniques); err == nil {
+			use(uniques, keys)
+		}
+	}
+
+	var plain, templates []string
+	for _, field := range sortedNames(generators) {
+		if generators[field].Type == GenerateTemplate {
+			templates = append(templates, field)
+		} else {
+			plain = append(plain, field)
+		}
+	}
+
+	seed := g.Seed
+	if seed == 0 {
+		seed = 1
+	}
+	rng := rand.New(rand.NewSource(seed))
+	rows := make([]Data, 0, g.Count)
+	for position := 0; position < g.Count; position++ {
+		var row Data
+		var keys []string
+		var clash *uniqueIndex
+		for attempt := 0; ; attempt++ {
+			if attempt == uniqueAttempts {
+				return nil, fmt.Errorf("unable to generate a unique %s for row %d", clash.field, position+1)
+			}
+			row = Data{}
+			for _, field := range plain {
+				row[field] = generators[field].value(rng, position, e.Table.fields[field])
+			}
+			for _, field := range templates {
+				row[field] = fillTemplate(generators[field].Template, row)
+			}
+			var err error
+			if keys, err = e.uniqueKeys(row, uniques); err != nil {
+				return nil, err
+			}
+			if clash = duplicate(uniques, keys); clash == nil {
+				break
+			}
+		}
+		use(uniques, keys)
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// keyGenerator numbers Int keys on from the largest seeded key, and gives
+// other keys uuids.
+func (e *Entity) keyGenerator(field string, seeded []Data) *Generator {
+	if e.Table.fields[field] != datatype.Int {
+		return &Generator{Type: GenerateUUID}
+	}
+	next := int64(1)
+	for _, row := range seeded {
+		if v, err := datatype.Int.Coerce(lowerKeys(row)[field]); err == nil && v.(int64) >= next {
+			next = v.(int64) + 1
+		}
+	}
+	return &Generator{Type: GenerateSequence, Start: next, Step: 1}
+}
+
+// uniqueIndex is a unique index of an entity being generated, with the keys
+// its rows already hold.
+type uniqueIndex struct {
+	field   string
+	indexer memdb.SingleIndexer
+	used    map[string]bool
+}
+
+// uniqueKeys returns the key row has in each unique index, empty if the index
+// leaves the row out.
+func (e *Entity) uniqueKeys(row Data, uniques []*uniqueIndex) ([]string, error) {
+	instance, err := e.Table.setValues(e.Table.getInstance(), row)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, len(uniques))
+	for i, unique := range uniques {
+		ok, key, err := unique.indexer.FromObject(instance.Interface())
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", unique.field, err)
+		}
+		if ok {
+			keys[i] = string(key)
+		}
+	}
+	return keys, nil
+}
+
+// duplicate returns the first unique index that already holds its key.
+func duplicate(uniques []*uniqueIndex, keys []string) *uniqueIndex {
+	for i, unique := range uniques {
+		if keys[i] != "" && unique.used[keys[i]] {
+			return unique
+		}
+	}
+	return nil
+}
+
+func use(uniques []*uniqueIndex, keys []string) {
+	for i, unique := range uniques {
+		if keys[i] != "" {
+			unique.used[keys[i]] = true
+		}
+	}
+}
+
+func lowerKeys(row Data) Data {
+	lowered := make(Data, len(row))
+	for k, v := range row {
+		lowered[lower.String(k)] = v
+	}
+	return lowered
+}
@@ -0,0 +1,54 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+const generatedPeople = `
+storage:
+  entities:
+    person:
+      fields: {id: Int, team: String, name: String}
+      indexes: {id: {field: id, unique: true}, member: %s}
+      generate: {count: 3, fields: {team: %s, name: {type: sequence}}}
+`
+
+func TestGenerateUniqueIndexes(t *testing.T) {
+	tests := []struct {
+		name  string
+		index string
+		team  string
+		err   string
+	}{
+		{"single", "{field: team, unique: true}", "{type: pick, values: [a, b, c, d, e, f]}", ""},
+		{"compound keyed on its first field", "{fields: [team, name], unique: true}", "{type: pick, values: [a, b]}", "unique team"},
+		{"compound with distinct first fields", "{fields: [team, name], unique: true}", "{type: template, template: 't{id}'}", ""},
+		{"empty values left out", "{field: team, unique: true}", "{type: pick, values: ['']}", ""},
+		{"not unique", "{field: team}", "{type: pick, values: [a]}", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := &Source{}
+			if err := yaml.Unmarshal([]byte(fmt.Sprintf(generatedPeople, tt.index, tt.team)), source); err != nil {
+				t.Fatal(err)
+			}
+			err := source.ConfigureMemDB(nil)
+			if tt.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if rows := selectRows(t, source.Storage, &Query{Entity: "person"}, ""); len(rows) != 3 {
+					t.Errorf("got %d rows, want 3", len(rows))
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) || !strings.Contains(err.Error(), "person") {
+				t.Errorf("error = %v, want one naming person and %q", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package models
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+// schema describes the parts of the entities that shape the database, so that
+// a reload can tell whether the existing database still fits.
+func (s *Store) schema() string {
+	var sb strings.Builder
+	for _, name := range sortedNames(s.Entities) {
+		entity := s.Entities[name]
+		fmt.Fprintf(&sb, "%s(", name)
+		for _, field := range sortedNames(entity.Table.fields) {
+			fmt.Fprintf(&sb, "%s:%s,", field, entity.Table.fields[field])
+		}
+		for _, key := range sortedNames(entity.Indexes) {
+			index := entity.Indexes[key]
+			if index == nil {
+				index = &Index{Field: key}
+			}
+			fields := index.Fields
+			if index.Field != "" {
+				fields = []string{index.Field}
+			}
+			fmt.Fprintf(&sb, "[%s:%s:%t]", lower.String(key), lower.String(strings.Join(fields, "+")), index.Unique)
+		}
+		sb.WriteString(")")
+	}
+	return sb.String()
+}
+
+// migrate copies the rows of the previous database into this one, keeping
+// the fields both schemas share and converting them to any new type. Fields
+// that cannot be converted, and new fields, take their default or generated
+// value, or are left at their zero value.
+// Entities that are new to the schema are seeded.
+func (s *Store) migrate(previous *Store) error {
+	txn := s.DB.Txn(true)
+	defer txn.Abort()
+	old := previous.DB.Txn(false)
+	defer old.Abort()
+
+	for _, name := range sortedNames(s.Entities) {
+		entity := s.Entities[name]
+		prev, ok := previous.Entities[name]
+		if !ok {
+			if err := s.seed(txn, name); err != nil {
+				return err
+			}
+			continue
+		}
+
+		it, err := old.Get(name, "id")
+		if err != nil {
+			return fmt.Errorf("migrating %s: %w", name, err)
+		}
+		for obj := it.Next(); obj != nil; obj = it.Next() {
+			row := Data{}
+			for field, value := range prev.Table.toData(obj) {
+				d, ok := entity.Table.fields[field]
+				if !ok {
+					continue
+				}
+				if row[field], err = d.Coerce(value); err != nil {
+					log.Printf("migrating %s: dropping %s: %v", name, field, err)
+					delete(row, field)
+				}
+			}
+			obj, violations, err := entity.build(txn, name, row, nil)
+			if err != nil {
+				return fmt.Errorf("migrating %s: %w", name, err)
+			}
+			if len(violations) > 0 {
+				return fmt.Errorf("migrating %s: %s", name, strings.Join(violations, "; "))
+			}
+			if err = txn.Insert(name, obj); err != nil {
+				return fmt.Errorf("migrating %s: %w", name, err)
+			}
+		}
+	}
+	txn.Commit()
+	return nil
+}
+
+func sortedNames[T any](m map[string]T) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,280 @@
+package models
+
+import (
+	"jrest/internal/handlers"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+const (
+	paramSort   = "sort"
+	paramFields = "fields"
+	paramExpand = "expand"
+)
+
+// listOptions holds the filters, ordering and projection requested through
+// the query string of a select with query_params enabled, e.g.
+//
+//	?age=30&sort=-age,name&fields=name,email&expand=orders
+//
+// along with any RSQL filter expression passed in the query's rsql parameter.
+type listOptions struct {
+	filters map[string][]interface{}
+	names   []string
+	sort    []sortKey
+	fields  []string
+	filter  predicate
+	hint    *indexHint
+	expand  []string
+}
+type sortKey struct {
+	field string
+	desc  bool
+}
+
+func (q *Query) reserved() map[string]bool {
+	reserved := map[string]bool{paramSort: true, paramFields: true, paramExpand: true}
+	if q.Rsql != "" {
+		reserved[q.Rsql] = true
+	}
+	return reserved
+}
+
+func (e *Entity) parseParams(query *Query, req *handlers.Request) (*listOptions, error) {
+	values := req.Query
+	opts := &listOptions{filters: make(map[string][]interface{})}
+	reserved := query.reserved()
+
+	if query.Rsql != "" {
+		expression, err := rawParam(req.RawQuery, query.Rsql)
+		if err != nil {
+			return nil, err
+		}
+		if expression != "" {
+			if opts.filter, opts.hint, err = e.parseFilter(expression); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if !query.QueryParams {
+		if query.ExpandParam {
+			if err := e.parseExpand(values, opts); err != nil {
+				return nil, err
+			}
+		}
+		return opts, nil
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if reserved[name] {
+			continue
+		}
+		field := lower.String(name)
+		if _, ok := e.Table.fields[field]; !ok {
+			return nil, statusErrorf(http.StatusBadRequest, "unknown filter field: %s", name)
+		}
+		for _, raw := range values[name] {
+			value, err := e.coerce(field, raw)
+			if err != nil {
+				return nil, err
+			}
+			opts.filters[field] = append(opts.filters[field], value)
+		}
+		opts.names = append(opts.names, field)
+	}
+
+	for _, name := range splitList(values.Get(paramSort)) {
+		key := sortKey{field: name}
+		if strings.HasPrefix(name, "-") {
+			key = sortKey{field: name[1:], desc: true}
+		} else if strings.HasPrefix(name, "+") {
+			key.field = name[1:]
+		}
+		key.field = lower.String(key.field)
+		if _, ok := e.Table.fields[key.field]; !ok {
+			return nil, statusErrorf(http.StatusBadRequest, "unknown sort field: %s", name)
+		}
+		opts.sort = append(opts.sort, key)
+	}
+
+	for _, name := range splitList(values.Get(paramFields)) {
+		field := lower.String(name)
+		if _, ok := e.Table.fields[field]; !ok {
+			return nil, statusErrorf(http.StatusBadRequest, "unknown projection field: %s", name)
+		}
+		opts.fields = append(opts.fields, field)
+	}
+
+	if err := e.parseExpand(values, opts); err != nil {
+		return nil, err
+	}
+	return opts, nil
+}
+
+// parseExpand reads the relations named by ?expand, which is all that a query
+// with just expand_param takes from the query string.
+func (e *Entity) parseExpand(values url.Values, opts *listOptions) error {
+	for _, name := range splitList(values.Get(paramExpand)) {
+		if _, ok := e.relation(name); !ok {
+			return statusErrorf(http.StatusBadRequest, "unknown relation: %s", name)
+		}
+		opts.expand = append(opts.expand, name)
+	}
+	return nil
+}
+
+// plan picks an index to scan for a query without a route filter: one over a
+// field that an equality filter fixes to a single value. Anything else, such
+// as a sort, scans the id index, since secondary indexes leave out the rows
+// that have no value.
+func (o *listOptions) plan(e *Entity) (string, []interface{}, bool) {
+	for _, field := range o.names {
+		if values := o.filters[field]; len(values) == 1 {
+			if name, ok := e.fieldIndex(field); ok && indexable(name, values[0]) {
+				return name, values, true
+			}
+		}
+	}
+	if o.hint != nil {
+		return o.hint.index, []interface{}{o.hint.value}, true
+	}
+	return "", nil, false
+}
+
+// indexable reports whether every row holding value is found through an
+// index. Secondary indexes leave out rows with an empty string.
+func indexable(index string, value interface{}) bool {
+	return index == "id" || value != ""
+}
+
+// fieldIndex returns the name of a single field index over field, if any.
+func (e *Entity) fieldIndex(field string) (string, bool) {
+	names := make([]string, 0, len(e.Indexes))
+	for name := range e.Indexes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		index := e.Indexes[name]
+		if index == nil || len(index.Fields) > 1 {
+			continue
+		}
+		if lower.String(e.indexField(index, 0)) == field {
+			return lower.String(name), true
+		}
+	}
+	return "", false
+}
+
+func (o *listOptions) matches(e *Entity, obj interface{}) bool {
+	if o.filter != nil && !o.filter(obj) {
+		return false
+	}
+	for field, values := range o.filters {
+		actual := e.Table.value(obj, field)
+		found := false
+		for _, v := range values {
+			if actual == v {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func (o *listOptions) sortRows(e *Entity, rows []interface{}) {
+	if len(o.sort) == 0 {
+		return
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		for _, key := range o.sort {
+			c := compareValues(e.Table.value(rows[i], key.field), e.Table.value(rows[j], key.field))
+			if c == 0 {
+				continue
+			}
+			if key.desc {
+				return c > 0
+			}
+			return c < 0
+		}
+		return false
+	})
+}
+
+func (o *listOptions) project(e *Entity, rows []interface{}) []interface{} {
+	if len(o.fields) == 0 {
+		return rows
+	}
+	projected := make([]interface{}, len(rows))
+	for i, obj := range rows {
+		m := make(map[string]interface{}, len(o.fields))
+		for _, field := range o.fields {
+			m[title.String(field)] = e.Table.value(obj, field)
+		}
+		projected[i] = m
+	}
+	return projected
+}
+
+func compareValues(a, b interface{}) int {
+	switch x := a.(type) {
+	case string:
+		y, _ := b.(string)
+		return strings.Compare(x, y)
+	case int64:
+		y, _ := b.(int64)
+		if x < y {
+			return -1
+		} else if x > y {
+			return 1
+		}
+	case bool:
+		y, _ := b.(bool)
+		if x == y {
+			return 0
+		} else if !x {
+			return -1
+		}
+		return 1
+	}
+	return 0
+}
+
+// rawParam returns the first value of a parameter in a raw query string.
+// Unlike url.ParseQuery it splits pairs on & alone, keeping the ; that RSQL
+// uses for "and".
+func rawParam(rawQuery, name string) (string, error) {
+	for _, pair := range strings.Split(rawQuery, "&") {
+		key, value, _ := strings.Cut(pair, "=")
+		key, err := url.QueryUnescape(key)
+		if err != nil || key != name {
+			continue
+		}
+		if value, err = url.QueryUnescape(value); err != nil {
+			return "", statusErrorf(http.StatusBadRequest, "invalid %s parameter: %v", name, err)
+		}
+		return value, nil
+	}
+	return "", nil
+}
+
+func splitList(value string) []string {
+	var list []string
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			list = append(list, part)
+		}
+	}
+	return list
+}
@@ -0,0 +1,97 @@
+package models
+
+import (
+	"encoding/json"
+	"jrest/internal/handlers"
+	"net/url"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func testSource(t *testing.T, config string) *Source {
+	t.Helper()
+	source := &Source{}
+	if err := yaml.Unmarshal([]byte(config), source); err != nil {
+		t.Fatal(err)
+	}
+	if err := source.ConfigureMemDB(nil); err != nil {
+		t.Fatal(err)
+	}
+	return source
+}
+
+func selectRows(t *testing.T, store *Store, query *Query, rawQuery string) []map[string]interface{} {
+	t.Helper()
+	values, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := &handlers.Request{Args: map[string]string{}, Query: values, RawQuery: rawQuery}
+	bs, _, err := store.Select(query, req)
+	if err != nil {
+		t.Fatalf("%s: %v", rawQuery, err)
+	}
+	var rows []map[string]interface{}
+	if err = json.Unmarshal(bs, &rows); err != nil {
+		t.Fatal(err)
+	}
+	return rows
+}
+
+const emptyValues = `
+storage:
+  entities:
+    person:
+      fields: {id: Int, email: String, boss: String}
+      indexes: {id: {field: id, unique: true}, email: {field: email}}
+      relations:
+        peers: {entity: person, type: one_to_many, field: boss, foreign_field: email}
+  data:
+    person:
+      - {id: 1, email: a@x}
+      - {id: 2}
+      - {id: 3, email: ""}
+`
+
+func TestListRowsWithEmptyIndexedValues(t *testing.T) {
+	store := testSource(t, emptyValues).Storage
+	query := &Query{Entity: "person", QueryParams: true, Rsql: "q"}
+
+	tests := []struct {
+		rawQuery string
+		ids      []float64
+	}{
+		{"sort=email", []float64{2, 3, 1}},
+		{"sort=-email", []float64{1, 2, 3}},
+		{"email=", []float64{2, 3}},
+		{"email=a@x", []float64{1}},
+		{"q=email==''", []float64{2, 3}},
+		{"q=email==a@x", []float64{1}},
+	}
+	for _, test := range tests {
+		rows := selectRows(t, store, query, test.rawQuery)
+		if len(rows) != len(test.ids) {
+			t.Errorf("%s: got %d rows, want %d", test.rawQuery, len(rows), len(test.ids))
+			continue
+		}
+		for i, row := range rows {
+			if row["Id"] != test.ids[i] {
+				t.Errorf("%s: row %d has id %v, want %v", test.rawQuery, i, row["Id"], test.ids[i])
+			}
+		}
+	}
+}
+
+func TestExpandRowsWithEmptyIndexedValues(t *testing.T) {
+	store := testSource(t, emptyValues).Storage
+	query := &Query{Entity: "person", QueryParams: true}
+	rows := selectRows(t, store, query, "id=2&expand=peers")
+	if len(rows) != 1 {
+		t.Fatalf("got %d rows, want 1", len(rows))
+	}
+	// Person 2 has no boss, which the email index holds no rows for.
+	if peers, _ := rows[0]["Peers"].([]interface{}); len(peers) != 2 {
+		t.Errorf("got %d peers, want 2", len(peers))
+	}
+}
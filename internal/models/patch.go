@@ -0,0 +1,170 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+const (
+	MediaMergePatch = "application/merge-patch+json"
+	MediaJSONPatch  = "application/json-patch+json"
+)
+
+// operation is a single step of a json patch document.
+type operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// patcher parses the body of an update into a function that applies it to a
+// stored row. A patch overlays the fields of a json object onto the row, a
+// merge patch (RFC 7396) also removes the fields it sets to null, and a json
+// patch (RFC 6902) applies a list of operations addressed by json pointer.
+func (e *Entity) patcher(action string, body []byte) (func(Data) error, error) {
+	switch action {
+	case ActionMergePatch:
+		changes := Data{}
+		if err := json.Unmarshal(body, &changes); err != nil {
+			return nil, statusErrorf(http.StatusBadRequest, "invalid merge patch: %v", err)
+		}
+		return func(row Data) error {
+			for field, value := range changes {
+				if value == nil {
+					delete(row, lower.String(field))
+				} else {
+					row[lower.String(field)] = value
+				}
+			}
+			return nil
+		}, nil
+	case ActionJSONPatch:
+		var operations []operation
+		if err := json.Unmarshal(body, &operations); err != nil {
+			return nil, statusErrorf(http.StatusBadRequest, "invalid json patch: %v", err)
+		}
+		for i, op := range operations {
+			switch op.Op {
+			case "add", "replace", "test":
+				if op.Value == nil {
+					return nil, statusErrorf(http.StatusBadRequest, "invalid json patch: operation %d: missing value", i)
+				}
+			case "remove", "move", "copy":
+			default:
+				return nil, statusErrorf(http.StatusBadRequest, "invalid json patch: operation %d: unknown op %q", i, op.Op)
+			}
+		}
+		return func(row Data) error {
+			for i, op := range operations {
+				if err := e.apply(row, op); err != nil {
+					return fmt.Errorf("operation %d: %w", i, err)
+				}
+			}
+			return nil
+		}, nil
+	}
+
+	changes := Data{}
+	if err := json.Unmarshal(body, &changes); err != nil {
+		return nil, statusErrorf(http.StatusBadRequest, "invalid request body: %v", err)
+	}
+	return func(row Data) error {
+		for field, value := range changes {
+			row[lower.String(field)] = value
+		}
+		return nil
+	}, nil
+}
+
+// apply performs a json patch operation on a row. Rows are flat, so every
+// pointer must name a single field.
+func (e *Entity) apply(row Data, op operation) error {
+	field, err := pointer(op.Path)
+	if err != nil {
+		return err
+	}
+	var value interface{}
+	if op.Value != nil {
+		if err = json.Unmarshal(op.Value, &value); err != nil {
+			return statusErrorf(http.StatusBadRequest, "invalid value: %v", err)
+		}
+	}
+
+	switch op.Op {
+	case "add":
+		row[field] = value
+	case "replace":
+		if _, ok := row[field]; !ok {
+			return statusErrorf(http.StatusUnprocessableEntity, "%s does not exist", op.Path)
+		}
+		row[field] = value
+	case "remove":
+		if _, ok := row[field]; !ok {
+			return statusErrorf(http.StatusUnprocessableEntity, "%s does not exist", op.Path)
+		}
+		delete(row, field)
+	case "move", "copy":
+		from, err := pointer(op.From)
+		if err != nil {
+			return err
+		}
+		v, ok := row[from]
+		if !ok {
+			return statusErrorf(http.StatusUnprocessableEntity, "%s does not exist", op.From)
+		}
+		if op.Op == "move" {
+			delete(row, from)
+		}
+		row[field] = v
+	case "test":
+		actual, ok := row[field]
+		if ok {
+			actual, err = e.coerce(field, actual)
+		}
+		expected, coerceErr := e.coerce(field, value)
+		if !ok || err != nil || coerceErr != nil || !reflect.DeepEqual(actual, expected) {
+			return statusErrorf(http.StatusConflict, "test of %s failed", op.Path)
+		}
+	}
+	return nil
+}
+
+// pointer returns the field named by a json pointer to a member of a row.
+func pointer(path string) (string, error) {
+	if !strings.HasPrefix(path, "/") {
+		return "", statusErrorf(http.StatusUnprocessableEntity, "path %q must name a field", path)
+	}
+	token := path[1:]
+	if strings.Contains(token, "/") {
+		return "", statusErrorf(http.StatusUnprocessableEntity, "path %q is below a field", path)
+	}
+	token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	return lower.String(token), nil
+}
+
+// typeCheck lists the fields of a patched row that the entity does not have
+// or whose values do not suit their type.
+func (t *Table) typeCheck(row Data) []string {
+	var violations []string
+	fields := make([]string, 0, len(row))
+	for field := range row {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		d, ok := t.fields[field]
+		if !ok {
+			violations = append(violations, fmt.Sprintf("unknown field: %s", field))
+			continue
+		}
+		if _, err := d.Coerce(row[field]); err != nil {
+			violations = append(violations, fmt.Sprintf("field %s: %v", field, err))
+		}
+	}
+	return violations
+}
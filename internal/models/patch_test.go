@@ -0,0 +1,113 @@
+package models
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+const patchedPeople = `
+storage:
+  entities:
+    person:
+      fields: {id: Int, name: String, nick: String, age: Int, active: Bool}
+      indexes: {id: {field: id, unique: true}}
+`
+
+func TestJSONPatch(t *testing.T) {
+	entity := testSource(t, patchedPeople).Storage.Entities["person"]
+	tests := []struct {
+		name   string
+		patch  string
+		want   Data
+		status int
+	}{
+		{"add", `[{"op": "add", "path": "/nick", "value": "jo"}]`,
+			Data{"id": 1.0, "name": "ann", "age": 30.0, "nick": "jo"}, 0},
+		{"add replaces", `[{"op": "add", "path": "/name", "value": "bo"}]`,
+			Data{"id": 1.0, "name": "bo", "age": 30.0}, 0},
+		{"add null", `[{"op": "add", "path": "/nick", "value": null}]`,
+			Data{"id": 1.0, "name": "ann", "age": 30.0, "nick": nil}, 0},
+		{"replace", `[{"op": "replace", "path": "/age", "value": 31}]`,
+			Data{"id": 1.0, "name": "ann", "age": 31.0}, 0},
+		{"replace missing", `[{"op": "replace", "path": "/nick", "value": "jo"}]`, nil, http.StatusUnprocessableEntity},
+		{"remove", `[{"op": "remove", "path": "/age"}]`,
+			Data{"id": 1.0, "name": "ann"}, 0},
+		{"remove missing", `[{"op": "remove", "path": "/nick"}]`, nil, http.StatusUnprocessableEntity},
+		{"move", `[{"op": "move", "from": "/name", "path": "/nick"}]`,
+			Data{"id": 1.0, "nick": "ann", "age": 30.0}, 0},
+		{"move missing", `[{"op": "move", "from": "/nick", "path": "/name"}]`, nil, http.StatusUnprocessableEntity},
+		{"copy", `[{"op": "copy", "from": "/name", "path": "/nick"}]`,
+			Data{"id": 1.0, "name": "ann", "nick": "ann", "age": 30.0}, 0},
+		{"test", `[{"op": "test", "path": "/age", "value": 30}, {"op": "replace", "path": "/age", "value": 31}]`,
+			Data{"id": 1.0, "name": "ann", "age": 31.0}, 0},
+		{"test coerces", `[{"op": "test", "path": "/age", "value": "30"}]`,
+			Data{"id": 1.0, "name": "ann", "age": 30.0}, 0},
+		{"test fails", `[{"op": "test", "path": "/age", "value": 31}, {"op": "remove", "path": "/age"}]`, nil, http.StatusConflict},
+		{"test missing", `[{"op": "test", "path": "/nick", "value": "jo"}]`, nil, http.StatusConflict},
+		{"pointer case", `[{"op": "add", "path": "/NICK", "value": "jo"}]`,
+			Data{"id": 1.0, "name": "ann", "age": 30.0, "nick": "jo"}, 0},
+		{"escaped pointer", `[{"op": "add", "path": "/a~1b~0c", "value": 1}]`,
+			Data{"id": 1.0, "name": "ann", "age": 30.0, "a/b~c": 1.0}, 0},
+		{"pointer below a field", `[{"op": "add", "path": "/name/first", "value": "jo"}]`, nil, http.StatusUnprocessableEntity},
+		{"pointer to the row", `[{"op": "add", "path": "", "value": {}}]`, nil, http.StatusUnprocessableEntity},
+		{"in order", `[{"op": "copy", "from": "/name", "path": "/nick"}, {"op": "replace", "path": "/name", "value": "bo"}, {"op": "test", "path": "/nick", "value": "ann"}]`,
+			Data{"id": 1.0, "name": "bo", "nick": "ann", "age": 30.0}, 0},
+		{"empty", `[]`, Data{"id": 1.0, "name": "ann", "age": 30.0}, 0},
+		{"unknown op", `[{"op": "merge", "path": "/name"}]`, nil, http.StatusBadRequest},
+		{"missing value", `[{"op": "add", "path": "/name"}]`, nil, http.StatusBadRequest},
+		{"not a list", `{"op": "add", "path": "/name", "value": "bo"}`, nil, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			row := Data{"id": 1.0, "name": "ann", "age": 30.0}
+			patch, err := entity.patcher(ActionJSONPatch, []byte(tt.patch))
+			if err == nil {
+				err = patch(row)
+			}
+			if tt.status != 0 {
+				var statusErr *StatusError
+				if !errors.As(err, &statusErr) || statusErr.Status != tt.status {
+					t.Fatalf("error = %v, want status %d", err, tt.status)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(row, tt.want) {
+				t.Errorf("row = %v, want %v", row, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergePatch(t *testing.T) {
+	entity := testSource(t, patchedPeople).Storage.Entities["person"]
+	tests := []struct {
+		name   string
+		action string
+		patch  string
+		want   Data
+	}{
+		{"merge sets", ActionMergePatch, `{"Name": "bo", "nick": "jo"}`, Data{"id": 1.0, "name": "bo", "nick": "jo", "age": 30.0}},
+		{"merge removes nulls", ActionMergePatch, `{"age": null, "nick": null}`, Data{"id": 1.0, "name": "ann"}},
+		{"patch keeps nulls", ActionPatch, `{"age": null}`, Data{"id": 1.0, "name": "ann", "age": nil}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			row := Data{"id": 1.0, "name": "ann", "age": 30.0}
+			patch, err := entity.patcher(tt.action, []byte(tt.patch))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = patch(row); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(row, tt.want) {
+				t.Errorf("row = %v, want %v", row, tt.want)
+			}
+		})
+	}
+}
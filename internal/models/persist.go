@@ -0,0 +1,317 @@
+package models
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-memdb"
+)
+
+const (
+	changePut    = "put"
+	changeDelete = "delete"
+
+	defaultSnapshotInterval = 30
+)
+
+// Persist keeps the store's rows in a snapshot file, rewritten every Interval
+// seconds when they have changed, which replaces the source data when the
+// store is next created. With Log set every change is also appended to the
+// snapshot's .log companion and replayed over the snapshot, so that nothing
+// written between snapshots is lost.
+type Persist struct {
+	File     string `json:"file" yaml:"file"`
+	Interval int    `json:"interval,omitempty" yaml:"interval,omitempty"`
+	Log      bool   `json:"log,omitempty" yaml:"log,omitempty"`
+
+	path    string
+	mu      sync.Mutex
+	dirty   bool
+	rewrite bool
+	stopped bool
+	log     *os.File
+	stop    chan struct{}
+}
+
+type change struct {
+	Op     string `json:"op"`
+	Entity string `json:"entity"`
+	Row    Data   `json:"row"`
+}
+
+// resolve locates the snapshot relative to the source file's directory.
+func (p *Persist) resolve(dir string) {
+	p.path = p.File
+	if !filepath.IsAbs(p.path) {
+		p.path = filepath.Join(dir, p.path)
+	}
+}
+
+func (p *Persist) logPath() string {
+	return p.path + ".log"
+}
+
+// restore loads the snapshot and change log into the database, reporting
+// whether either existed.
+func (s *Store) restore() (bool, error) {
+	p := s.Persist
+	bs, err := os.ReadFile(p.path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return false, err
+	}
+	found := err == nil
+
+	txn := s.DB.Txn(true)
+	defer txn.Abort()
+	if found {
+		data := map[string][]Data{}
+		if err = json.Unmarshal(bs, &data); err != nil {
+			return false, fmt.Errorf("snapshot %s: %w", p.path, err)
+		}
+		for name, rows := range data {
+			for _, row := range rows {
+				if err = s.apply(txn, change{Op: changePut, Entity: name, Row: row}); err != nil {
+					return false, fmt.Errorf("snapshot %s: %w", p.path, err)
+				}
+			}
+		}
+	}
+
+	f, err := os.Open(p.logPath())
+	if err == nil {
+		defer func() { _ = f.Close() }()
+		found = true
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		for line := 1; scanner.Scan(); line++ {
+			var c change
+			if err = json.Unmarshal(scanner.Bytes(), &c); err != nil {
+				// A partial last line is left by a crash mid write.
+				log.Printf("change log %s: ignoring line %d: %v", p.logPath(), line, err)
+				continue
+			}
+			if err = s.apply(txn, c); err != nil {
+				return false, fmt.Errorf("change log %s line %d: %w", p.logPath(), line, err)
+			}
+		}
+		if err = scanner.Err(); err != nil {
+			return false, err
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return false, err
+	}
+	txn.Commit()
+	return found, nil
+}
+
+func (s *Store) apply(txn *memdb.Txn, c change) error {
+	entity, err := s.entity(c.Entity)
+	if err != nil {
+		return err
+	}
+	instance, err := entity.Table.setValues(entity.Table.getInstance(), c.Row)
+	if err != nil {
+		return err
+	}
+	switch c.Op {
+	case changePut:
+		return txn.Insert(c.Entity, instance.Interface())
+	case changeDelete:
+		if err = txn.Delete(c.Entity, instance.Interface()); errors.Is(err, memdb.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+	return fmt.Errorf("unknown change: %s", c.Op)
+}
+
+// changed marks a store that was not restored from its snapshot as needing
+// one.
+func (s *Store) changed() {
+	if s.Persist != nil {
+		s.Persist.mu.Lock()
+		defer s.Persist.mu.Unlock()
+		s.Persist.dirty = true
+	}
+}
+
+// replaced marks a store whose rows were migrated or reseeded rather than
+// written through record, so that the change log no longer describes them.
+func (s *Store) replaced() {
+	if s.Persist != nil {
+		s.Persist.mu.Lock()
+		defer s.Persist.mu.Unlock()
+		s.Persist.dirty = true
+		s.Persist.rewrite = true
+	}
+}
+
+// record notes changes made by a write transaction, which must not yet have
+// been committed so that changes are logged in the order they are made.
+func (s *Store) record(op, entity string, rows ...interface{}) error {
+	p := s.Persist
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.dirty = true
+	if p.log == nil {
+		return nil
+	}
+	table := s.Entities[entity].Table
+	var buf []byte
+	for _, obj := range rows {
+		bs, err := json.Marshal(change{Op: op, Entity: entity, Row: table.toData(obj)})
+		if err != nil {
+			return err
+		}
+		buf = append(append(buf, bs...), '\n')
+	}
+	_, err := p.log.Write(buf)
+	return err
+}
+
+// StartPersist opens the change log and starts writing periodic snapshots.
+func (s *Store) StartPersist() error {
+	p := s.Persist
+	if p == nil || s.DB == nil {
+		return nil
+	}
+	if p.Log {
+		f, err := os.OpenFile(p.logPath(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		p.log = f
+	}
+
+	interval := p.Interval
+	if interval <= 0 {
+		interval = defaultSnapshotInterval
+	}
+	p.stop = make(chan struct{})
+	go func(stop chan struct{}) {
+		ticker := time.NewTicker(time.Duration(interval) * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := s.Snapshot(); err != nil {
+					log.Printf("unable to write snapshot %s: %v", p.path, err)
+				}
+			case <-stop:
+				return
+			}
+		}
+	}(p.stop)
+	return nil
+}
+
+// StopPersist stops the periodic snapshots and closes the change log.
+func (s *Store) StopPersist() {
+	p := s.Persist
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stopped = true
+	if p.stop != nil {
+		close(p.stop)
+		p.stop = nil
+	}
+	if p.log != nil {
+		_ = p.log.Close()
+		p.log = nil
+	}
+}
+
+// Snapshot writes the rows to the snapshot file if they have changed since
+// the last one, then empties the change log.
+func (s *Store) Snapshot() error {
+	p := s.Persist
+	if p == nil || s.DB == nil {
+		return nil
+	}
+	// A write transaction holds off changes until the snapshot is written.
+	txn := s.DB.Txn(true)
+	defer txn.Abort()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	// A stopped store has handed the snapshot to the one replacing it.
+	if !p.dirty || p.stopped {
+		return nil
+	}
+
+	bs, err := json.MarshalIndent(s.export(txn), "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := p.path + ".tmp"
+	if err = os.WriteFile(tmp, append(bs, '\n'), 0644); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, p.path); err != nil {
+		return err
+	}
+	if p.log != nil {
+		if err = p.log.Truncate(0); err != nil {
+			return err
+		}
+	}
+	p.dirty = false
+	p.rewrite = false
+	return nil
+}
+
+// Rewrite writes a snapshot, emptying the change log, if ConfigureMemDB
+// migrated or reseeded the rows. It is called once the store is served and
+// the previous one stopped, so that no change is recorded in between.
+func (s *Store) Rewrite() error {
+	p := s.Persist
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	rewrite := p.rewrite
+	p.mu.Unlock()
+	if !rewrite {
+		return nil
+	}
+	return s.Snapshot()
+}
+
+// Export returns the rows of every entity in the form of the source data.
+func (s *Store) Export() map[string][]Data {
+	if s.DB == nil {
+		return s.Data
+	}
+	txn := s.DB.Txn(false)
+	defer txn.Abort()
+	return s.export(txn)
+}
+
+func (s *Store) export(txn *memdb.Txn) map[string][]Data {
+	data := make(map[string][]Data, len(s.Entities))
+	for name, entity := range s.Entities {
+		table := entity.Table
+		it, err := txn.Get(name, "id")
+		if err != nil {
+			continue
+		}
+		rows := []Data{}
+		for obj := it.Next(); obj != nil; obj = it.Next() {
+			rows = append(rows, table.toData(obj))
+		}
+		data[name] = rows
+	}
+	return data
+}
@@ -0,0 +1,285 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+
+	"jrest/internal/handlers"
+
+	"github.com/hashicorp/go-memdb"
+)
+
+const (
+	RelationOneToMany = "one_to_many"
+	RelationManyToOne = "many_to_one"
+
+	OnDeleteRestrict = "restrict"
+	OnDeleteCascade  = "cascade"
+)
+
+// Relation links the rows of an entity to those of another whose Foreign
+// field equals the entity's Field. A one to many relation's Field defaults to
+// the entity's key, and a many to one relation's Foreign to the related
+// entity's key. Selects may embed related rows through their expand setting
+// or, with query_params or expand_param, ?expand=name.
+//
+// Whichever side declares it, a relation stops a child row from referring to
+// a parent that does not exist, and OnDelete decides whether deleting a
+// parent is refused while it has children (restrict, the default) or also
+// deletes them (cascade).
+type Relation struct {
+	Entity   string `json:"entity" yaml:"entity"`
+	Type     string `json:"type" yaml:"type"`
+	Field    string `json:"field,omitempty" yaml:"field,omitempty"`
+	Foreign  string `json:"foreign_field,omitempty" yaml:"foreign_field,omitempty"`
+	OnDelete string `json:"on_delete,omitempty" yaml:"on_delete,omitempty"`
+}
+
+// link is a relation seen from the parent side.
+type link struct {
+	parent, parentField string
+	child, childField   string
+	onDelete            string
+}
+
+// keyField returns the field of the entity's id index.
+func (e *Entity) keyField() string {
+	if index := e.index("id"); index != nil {
+		return lower.String(e.indexField(index, 0))
+	}
+	return ""
+}
+
+func (e *Entity) relation(name string) (*Relation, bool) {
+	for key, relation := range e.Relations {
+		if lower.String(key) == lower.String(name) {
+			return relation, true
+		}
+	}
+	return nil, false
+}
+
+// relate checks the relations of every entity and records their links.
+func (s *Store) relate() error {
+	s.links = nil
+	seen := make(map[string]*link)
+	for _, name := range sortedNames(s.Entities) {
+		entity := s.Entities[name]
+		for _, relationName := range sortedNames(entity.Relations) {
+			r := entity.Relations[relationName]
+			if r == nil {
+				return fmt.Errorf("relation %s.%s: missing definition", name, relationName)
+			}
+			related, ok := s.Entities[r.Entity]
+			if !ok {
+				return fmt.Errorf("relation %s.%s: unknown entity", name, relationName)
+			}
+			r.Field, r.Foreign = lower.String(r.Field), lower.String(r.Foreign)
+
+			var l *link
+			switch r.Type {
+			case RelationOneToMany:
+				if r.Field == "" {
+					r.Field = entity.keyField()
+				}
+				l = &link{parent: name, parentField: r.Field, child: r.Entity, childField: r.Foreign}
+			case RelationManyToOne:
+				if r.Foreign == "" {
+					r.Foreign = related.keyField()
+				}
+				l = &link{parent: r.Entity, parentField: r.Foreign, child: name, childField: r.Field}
+			default:
+				return fmt.Errorf("relation %s.%s: unknown type %q", name, relationName, r.Type)
+			}
+			if _, ok = entity.Table.fields[r.Field]; !ok {
+				return fmt.Errorf("relation %s.%s: unknown field %q", name, relationName, r.Field)
+			}
+			if _, ok = related.Table.fields[r.Foreign]; !ok {
+				return fmt.Errorf("relation %s.%s: unknown foreign field %q", name, relationName, r.Foreign)
+			}
+			switch r.OnDelete {
+			case "", OnDeleteRestrict, OnDeleteCascade:
+			default:
+				return fmt.Errorf("relation %s.%s: unknown on_delete %q", name, relationName, r.OnDelete)
+			}
+
+			key := fmt.Sprintf("%s.%s>%s.%s", l.parent, l.parentField, l.child, l.childField)
+			if existing, ok := seen[key]; ok {
+				if r.OnDelete != "" {
+					existing.onDelete = r.OnDelete
+				}
+				continue
+			}
+			l.onDelete = r.OnDelete
+			seen[key] = l
+			s.links = append(s.links, l)
+		}
+	}
+	return nil
+}
+
+// related returns the rows of an entity whose field equals value.
+func (s *Store) related(txn *memdb.Txn, name, field string, value interface{}) ([]interface{}, error) {
+	entity := s.Entities[name]
+	index, indexed := entity.fieldIndex(field)
+	indexed = indexed && indexable(index, value)
+	var it memdb.ResultIterator
+	var err error
+	if indexed {
+		it, err = txn.Get(name, index, value)
+	} else {
+		it, err = txn.Get(name, "id")
+	}
+	if err != nil {
+		return nil, err
+	}
+	rows := make([]interface{}, 0)
+	for obj := it.Next(); obj != nil; obj = it.Next() {
+		if indexed || entity.Table.value(obj, field) == value {
+			rows = append(rows, obj)
+		}
+	}
+	return rows, nil
+}
+
+// checkReferences ensures that rows written to an entity refer to existing
+// parents. A reference left at its zero value refers to nothing.
+func (s *Store) checkReferences(txn *memdb.Txn, name string, rows []interface{}) error {
+	for _, l := range s.links {
+		if l.child != name {
+			continue
+		}
+		table := s.Entities[name].Table
+		for _, obj := range rows {
+			value := table.value(obj, l.childField)
+			if isZero(value) {
+				continue
+			}
+			parents, err := s.related(txn, l.parent, l.parentField, value)
+			if err != nil {
+				return err
+			}
+			if len(parents) == 0 {
+				return statusErrorf(http.StatusConflict, "%s %s %v refers to no %s", name, l.childField, value, l.parent)
+			}
+		}
+	}
+	return nil
+}
+
+// remove deletes rows from an entity, applying the delete rule of every link
+// to their children first.
+func (s *Store) remove(txn *memdb.Txn, name string, rows []interface{}) error {
+	return s.removeRows(txn, name, rows, make(map[string]bool))
+}
+
+// removeRows is remove for a cascade, where visited holds the rows already
+// being removed so that cycles of relations end.
+func (s *Store) removeRows(txn *memdb.Txn, name string, rows []interface{}, visited map[string]bool) error {
+	entity := s.Entities[name]
+	for _, obj := range rows {
+		visited[rowKey(entity, name, obj)] = true
+	}
+	for _, l := range s.links {
+		if l.parent != name {
+			continue
+		}
+		for _, obj := range rows {
+			value := entity.Table.value(obj, l.parentField)
+			if isZero(value) {
+				continue
+			}
+			related, err := s.related(txn, l.child, l.childField, value)
+			if err != nil {
+				return err
+			}
+			children := related[:0]
+			for _, child := range related {
+				if !visited[rowKey(s.Entities[l.child], l.child, child)] {
+					children = append(children, child)
+				}
+			}
+			if len(children) == 0 {
+				continue
+			}
+			if l.onDelete != OnDeleteCascade {
+				return statusErrorf(http.StatusConflict, "%s %v is referred to by %d %s", name, value, len(children), l.child)
+			}
+			if err = s.removeRows(txn, l.child, children, visited); err != nil {
+				return err
+			}
+		}
+	}
+	for _, obj := range rows {
+		if err := txn.Delete(name, obj); err != nil && !errors.Is(err, memdb.ErrNotFound) {
+			return err
+		}
+	}
+	return s.record(changeDelete, name, rows...)
+}
+
+func rowKey(entity *Entity, name string, obj interface{}) string {
+	return fmt.Sprintf("%s\x00%v", name, entity.key(obj))
+}
+
+// expand embeds the related rows named by expand into each output row, under
+// the relation's name. One to many relations embed a list, many to one
+// relations the parent or null.
+func (s *Store) expand(txn *memdb.Txn, name string, expand []string, req *handlers.Request, rows, out []interface{}) ([]interface{}, error) {
+	if len(expand) == 0 {
+		return out, nil
+	}
+	entity := s.Entities[name]
+	expanded := make([]interface{}, len(out))
+	for i, row := range out {
+		m, ok := row.(map[string]interface{})
+		if !ok {
+			m = entity.Table.toMap(row)
+		}
+		expanded[i] = m
+	}
+
+	for _, relationName := range expand {
+		r, ok := entity.relation(relationName)
+		if !ok {
+			return nil, statusErrorf(http.StatusBadRequest, "unknown relation: %s", relationName)
+		}
+		related := s.Entities[r.Entity]
+		owner, err := related.ownerValue(req)
+		if err != nil {
+			return nil, err
+		}
+		for i, obj := range rows {
+			matches, err := s.related(txn, r.Entity, r.Foreign, entity.Table.value(obj, r.Field))
+			if err != nil {
+				return nil, err
+			}
+			if owner != nil {
+				owned := matches[:0]
+				for _, match := range matches {
+					if related.Table.value(match, related.Owner.Field) == owner {
+						owned = append(owned, match)
+					}
+				}
+				matches = owned
+			}
+			m := expanded[i].(map[string]interface{})
+			key := title.String(relationName)
+			if r.Type == RelationManyToOne {
+				m[key] = nil
+				if len(matches) > 0 {
+					m[key] = matches[0]
+				}
+			} else {
+				m[key] = matches
+			}
+		}
+	}
+	return expanded, nil
+}
+
+func isZero(value interface{}) bool {
+	return value == nil || reflect.ValueOf(value).IsZero()
+}
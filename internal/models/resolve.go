@@ -0,0 +1,42 @@
+package models
+
+import (
+	"fmt"
+	"jrest/internal/handlers"
+	"net/http"
+	"strings"
+)
+
+// StatusError is returned by store operations that should be reported to the
+// caller with a specific http status rather than as an internal error. When a
+// Response is configured its content and headers replace the message.
+type StatusError struct {
+	Status   int
+	Message  string
+	Response *ErrorResponse
+}
+
+func (e *StatusError) Error() string {
+	return e.Message
+}
+
+func statusErrorf(status int, format string, a ...interface{}) error {
+	return &StatusError{Status: status, Message: fmt.Sprintf(format, a...)}
+}
+
+func isPlaceholder(value string) bool {
+	return len(value) > 2 && strings.HasPrefix(value, "{") && strings.HasSuffix(value, "}")
+}
+
+// resolve returns the value of a placeholder, either a path argument such as
+// {name} or a request attribute such as {auth.user.tenant_id}. Anything that
+// is not a placeholder is returned unchanged.
+func resolve(value string, req *handlers.Request) (interface{}, error) {
+	if !isPlaceholder(value) {
+		return value, nil
+	}
+	if v, ok := req.Lookup(value[1 : len(value)-1]); ok {
+		return v, nil
+	}
+	return nil, statusErrorf(http.StatusForbidden, "unable to resolve %s", value)
+}
@@ -0,0 +1,151 @@
+package models
+
+import (
+	"fmt"
+	"jrest/internal/models/enums/datatype"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+const (
+	OperationList    = "list"
+	OperationCreate  = "create"
+	OperationGet     = "get"
+	OperationReplace = "replace"
+	OperationPatch   = "patch"
+	OperationDelete  = "delete"
+)
+
+// Resource generates the REST surface for an entity under a path:
+//
+//	GET    path        list      POST   path        create
+//	GET    path/{key}  get       PUT    path/{key}  replace
+//	PATCH  path/{key}  patch     DELETE path/{key}  delete
+//
+// where key is the field of the entity's unique index. Any generated response
+// may be replaced through Responses, keyed on the operation name. A generated
+// path may not match the same requests as a declared path.
+type Resource struct {
+	Entity         string               `json:"entity" yaml:"entity"`
+	Key            string               `json:"key,omitempty" yaml:"key,omitempty"`
+	Rsql           string               `json:"rsql,omitempty" yaml:"rsql,omitempty"`
+	Authentication *Authentication      `json:"auth,omitempty" yaml:"auth,omitempty"`
+	Cors           *Cors                `json:"cors,omitempty" yaml:"cors,omitempty"`
+	Responses      map[string]*Response `json:"responses,omitempty" yaml:"responses,omitempty"`
+}
+
+// ApplyResources adds the paths generated for each resource.
+func (s *Source) ApplyResources() error {
+	names := make([]string, 0, len(s.Resources))
+	for name := range s.Resources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		resource := s.Resources[name]
+		if s.Storage == nil {
+			return fmt.Errorf("resource %s: no storage configured", name)
+		}
+		entity, ok := s.Storage.Entities[resource.Entity]
+		if !ok {
+			return fmt.Errorf("resource %s: unknown entity: %s", name, resource.Entity)
+		}
+		keyIndex, err := resource.keyIndex(entity)
+		if err != nil {
+			return fmt.Errorf("resource %s: %w", name, err)
+		}
+		field := lower.String(entity.indexField(entity.Indexes[keyIndex], 0))
+
+		path := strings.Trim(lower.String(name), "/")
+		if err = s.Paths.processPath(path, resource.collection()); err != nil {
+			return fmt.Errorf("resource %s: %w", name, err)
+		}
+		placeholder := field
+		if entity.Table.fields[field] == datatype.Int {
+			placeholder = fmt.Sprintf("%s:%s", field, kindInt)
+		}
+		if err = s.Paths.processPath(fmt.Sprintf("%s/{%s}", path, placeholder), resource.item(keyIndex, field)); err != nil {
+			return fmt.Errorf("resource %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// keyIndex returns the declared key index, or the id index when it is unique,
+// or else the first unique index by name.
+func (r *Resource) keyIndex(entity *Entity) (string, error) {
+	if r.Key != "" {
+		for name := range entity.Indexes {
+			if lower.String(name) == lower.String(r.Key) {
+				return name, nil
+			}
+		}
+		return "", fmt.Errorf("unknown key index: %s", r.Key)
+	}
+	names := make([]string, 0, len(entity.Indexes))
+	for name, index := range entity.Indexes {
+		if index != nil && index.Unique {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return "", fmt.Errorf("entity %s has no unique index", r.Entity)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if lower.String(names[i]) == "id" {
+			return true
+		} else if lower.String(names[j]) == "id" {
+			return false
+		}
+		return names[i] < names[j]
+	})
+	return names[0], nil
+}
+
+func (r *Resource) collection() *Path {
+	return &Path{
+		Authentication: r.Authentication,
+		Cors:           r.Cors,
+		Methods: Methods{
+			http.MethodGet: r.response(OperationList, &Response{
+				Select: &Query{Entity: r.Entity, QueryParams: true, Rsql: r.Rsql},
+			}),
+			http.MethodPost: r.response(OperationCreate, &Response{
+				Insert: &Query{Entity: r.Entity},
+			}),
+		},
+	}
+}
+
+func (r *Resource) item(index, field string) *Path {
+	filter := func() *Filter {
+		return &Filter{Index: &index, Fields: []string{fmt.Sprintf("{%s}", field)}}
+	}
+	return &Path{
+		Authentication: r.Authentication,
+		Cors:           r.Cors,
+		Methods: Methods{
+			http.MethodGet: r.response(OperationGet, &Response{
+				Select: &Query{Entity: r.Entity, ExpandParam: true, Filter: filter(), Single: true},
+			}),
+			http.MethodPut: r.response(OperationReplace, &Response{
+				Update: &Query{Entity: r.Entity, Action: ActionReplace, Filter: filter()},
+			}),
+			http.MethodPatch: r.response(OperationPatch, &Response{
+				Update: &Query{Entity: r.Entity, Action: ActionPatch, Filter: filter()},
+			}),
+			http.MethodDelete: r.response(OperationDelete, &Response{
+				Delete: &Query{Entity: r.Entity, Filter: filter(), Single: true},
+			}),
+		},
+	}
+}
+
+func (r *Resource) response(operation string, generated *Response) *Response {
+	if override, ok := r.Responses[operation]; ok && override != nil {
+		return override
+	}
+	return generated
+}
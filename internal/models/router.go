@@ -0,0 +1,293 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Paths routes request paths through a trie of segments. At every level a
+// literal segment is preferred over a constrained placeholder, a constrained
+// placeholder over a plain one and a plain one over a catch-all, falling back
+// to the next candidate when a deeper segment fails to match. Routes are added
+// in name order so that the result does not depend on the source format.
+// Routes that match exactly the same paths are an error; routes that share
+// only some paths are reported by overlaps.
+type Paths struct {
+	audit  []string
+	root   *node
+	routes []*route
+}
+type route struct {
+	template string
+	segments []*segment
+	path     *Path
+}
+type node struct {
+	literals map[string]*node
+	params   []*edge
+	catchAll *edge
+	route    *route
+}
+type edge struct {
+	key  string
+	seg  *segment
+	next *node
+}
+
+func (ps *Paths) init() {
+	ps.audit = []string{}
+	ps.root = newNode()
+	ps.routes = nil
+}
+
+func newNode() *node {
+	return &node{literals: make(map[string]*node)}
+}
+
+func (ps *Paths) UnmarshalYAML(value *yaml.Node) error {
+	ps.init()
+	tmp := make(map[string]*Path)
+	for index := 0; index < len(value.Content); index += 2 {
+		path := &Path{}
+		err := value.Content[index+1].Decode(path)
+		if err != nil {
+			return err
+		}
+		tmp[value.Content[index].Value] = path
+	}
+	return ps.processPaths(tmp)
+}
+
+func (ps *Paths) UnmarshalJSON(data []byte) error {
+	ps.init()
+	tmp := make(map[string]*Path)
+	err := json.Unmarshal(data, &tmp)
+	if err != nil {
+		return err
+	}
+	return ps.processPaths(tmp)
+}
+
+func (ps *Paths) processPaths(paths map[string]*Path) error {
+	names := make([]string, 0, len(paths))
+	for name := range paths {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := ps.processPath(strings.TrimPrefix(name, "/"), paths[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ps *Paths) processPath(name string, path *Path) error {
+	if ps.root == nil {
+		ps.init()
+	}
+	r := &route{template: name, path: path}
+	parts := strings.Split(name, "/")
+	for index, part := range parts {
+		seg, err := parseSegment(part)
+		if err != nil {
+			return fmt.Errorf("path %s: %w", name, err)
+		}
+		if seg.catchAll && index != len(parts)-1 {
+			return fmt.Errorf("path %s: catch-all {%s...} must be the last segment", name, seg.param)
+		}
+		r.segments = append(r.segments, seg)
+	}
+
+	n := ps.root
+	for _, seg := range r.segments {
+		n = n.child(seg)
+	}
+	if n.route != nil {
+		return fmt.Errorf("ambiguous routes: %s and %s match the same paths", n.route.template, name)
+	}
+	n.route = r
+	ps.routes = append(ps.routes, r)
+
+	methods := make([]string, 0, len(path.Methods))
+	for method := range path.Methods {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	for _, method := range methods {
+		ps.audit = append(ps.audit, fmt.Sprintf("  %-6s %s", fmt.Sprintf("%s:", method), name))
+	}
+	return nil
+}
+
+// child returns the node reached from n through seg, adding it if necessary.
+// Placeholders with the same constraint share a node whatever their names.
+func (n *node) child(seg *segment) *node {
+	switch {
+	case seg.catchAll:
+		if n.catchAll == nil {
+			n.catchAll = &edge{key: "...", seg: seg, next: newNode()}
+		}
+		return n.catchAll.next
+	case seg.isParam():
+		key := seg.constraint()
+		for _, e := range n.params {
+			if e.key == key {
+				return e.next
+			}
+		}
+		e := &edge{key: key, seg: seg, next: newNode()}
+		n.params = append(n.params, e)
+		sort.SliceStable(n.params, func(i, j int) bool {
+			return n.params[i].seg.precedes(n.params[j].seg)
+		})
+		return e.next
+	}
+	next, ok := n.literals[seg.literal]
+	if !ok {
+		next = newNode()
+		n.literals[seg.literal] = next
+	}
+	return next
+}
+
+func (n *node) match(parts []string, values []string) (*route, []string) {
+	if len(parts) == 0 {
+		if n.route != nil {
+			return n.route, values
+		}
+		return nil, nil
+	}
+	part := parts[0]
+	if next, ok := n.literals[lower.String(part)]; ok {
+		if r, v := next.match(parts[1:], values); r != nil {
+			return r, v
+		}
+	}
+	for _, e := range n.params {
+		if part == "" || !e.seg.accepts(part) {
+			continue
+		}
+		if r, v := e.next.match(parts[1:], append(values, part)); r != nil {
+			return r, v
+		}
+	}
+	if n.catchAll != nil && n.catchAll.next.route != nil {
+		return n.catchAll.next.route, append(values, strings.Join(parts, "/"))
+	}
+	return nil, nil
+}
+
+// Match is the route selected for a request path together with the values of
+// its placeholders, keyed on the placeholder, e.g. {name}.
+type Match struct {
+	Path     *Path
+	Template string
+	Args     map[string]string
+}
+
+func (ps *Paths) MatchPath(path string) (*Match, bool) {
+	if ps.root == nil {
+		return nil, false
+	}
+	r, values := ps.root.match(strings.Split(path, "/"), nil)
+	if r == nil {
+		return nil, false
+	}
+
+	arguments := make(map[string]string)
+	position := 0
+	for _, seg := range r.segments {
+		if seg.isParam() {
+			arguments[seg.placeholder()] = values[position]
+			position++
+		}
+	}
+	return &Match{Path: r.path, Template: r.template, Args: arguments}, true
+}
+
+// StripBase removes base from a request path, which must equal the base or
+// continue it with a slash.
+func StripBase(base, path string) (string, bool) {
+	if !strings.HasPrefix(path, base) {
+		return "", false
+	}
+	rest := path[len(base):]
+	if rest != "" && rest[0] != '/' {
+		return "", false
+	}
+	return strings.TrimPrefix(rest, "/"), true
+}
+
+// Serves reports whether a request for path, base included, reaches one of
+// the source's routes.
+func (s *Source) Serves(path string) bool {
+	rest, ok := StripBase(s.Base, path)
+	if !ok {
+		return false
+	}
+	_, ok = s.Paths.MatchPath(rest)
+	return ok
+}
+
+// overlaps describes each pair of routes that match a common path, with an
+// example path and the route that serves it.
+func (ps *Paths) overlaps() []string {
+	var overlaps []string
+	for i, a := range ps.routes {
+		for _, b := range ps.routes[i+1:] {
+			witness, ok := overlap(a.segments, b.segments)
+			if !ok {
+				continue
+			}
+			served := "neither"
+			if match, ok := ps.MatchPath(witness); ok {
+				served = match.Template
+			}
+			overlaps = append(overlaps, fmt.Sprintf("routes %s and %s overlap, %s is served by %s", a.template, b.template, witness, served))
+		}
+	}
+	return overlaps
+}
+
+// overlap returns a path matched by both lists of segments, if one is found.
+func overlap(a, b []*segment) (string, bool) {
+	var parts []string
+	for i := 0; i < len(a) || i < len(b); i++ {
+		switch {
+		case i < len(a) && a[i].catchAll:
+			return strings.Join(append(parts, samples(b[i:])...), "/"), i < len(b)
+		case i < len(b) && b[i].catchAll:
+			return strings.Join(append(parts, samples(a[i:])...), "/"), i < len(a)
+		case i >= len(a) || i >= len(b):
+			return "", false
+		}
+		part, ok := a[i].shared(b[i])
+		if !ok {
+			return "", false
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, "/"), true
+}
+
+// samples returns a value accepted by each segment.
+func samples(segments []*segment) []string {
+	parts := make([]string, len(segments))
+	for i, seg := range segments {
+		parts[i] = seg.sample()
+	}
+	return parts
+}
+
+func (ps *Paths) All() []*Path {
+	paths := make([]*Path, 0, len(ps.routes))
+	for _, r := range ps.routes {
+		paths = append(paths, r.path)
+	}
+	return paths
+}
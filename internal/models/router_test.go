@@ -0,0 +1,151 @@
+package models
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testPaths(t *testing.T, templates ...string) (*Paths, error) {
+	t.Helper()
+	paths := make(map[string]*Path, len(templates))
+	for _, template := range templates {
+		paths[template] = &Path{}
+	}
+	ps := &Paths{}
+	ps.init()
+	return ps, ps.processPaths(paths)
+}
+
+func TestAmbiguousRoutes(t *testing.T) {
+	tests := [][]string{
+		{"people/{id}", "people/{name}"},
+		{"people/{id:int}", "people/{n:INT}"},
+		{"files/{rest...}", "files/{path...}"},
+		{"people", "/people"},
+		{"People", "people"},
+	}
+	for _, templates := range tests {
+		t.Run(strings.Join(templates, " "), func(t *testing.T) {
+			if _, err := testPaths(t, templates...); err == nil || !strings.Contains(err.Error(), "ambiguous routes") {
+				t.Errorf("error = %v, want ambiguous routes", err)
+			}
+		})
+	}
+}
+
+func TestOverlappingRoutes(t *testing.T) {
+	tests := []struct {
+		templates []string
+		want      []string
+	}{
+		{[]string{"people/me", "people/{id}"}, []string{"routes people/me and people/{id} overlap, people/me is served by people/me"}},
+		{[]string{"people/{id:int}", "people/{name}"}, []string{"routes people/{id:int} and people/{name} overlap, people/1 is served by people/{id:int}"}},
+		{[]string{"files/{rest...}", "files/{name}"}, []string{"routes files/{name} and files/{rest...} overlap, files/x is served by files/{name}"}},
+		{[]string{"files/{rest...}", "files/a/b"}, []string{"routes files/a/b and files/{rest...} overlap, files/a/b is served by files/a/b"}},
+		{[]string{"blog/{slug:[a-z]+}", "blog/{id:int}"}, nil},
+		{[]string{"blog/{slug:[a-z0-9]+}", "blog/{id:int}"}, []string{"routes blog/{id:int} and blog/{slug:[a-z0-9]+} overlap, blog/1 is served by blog/{id:int}"}},
+		{[]string{"people/{id}", "people/{id}/books"}, nil},
+		{[]string{"files", "files/{rest...}"}, nil},
+		{[]string{"people", "books"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.templates, " "), func(t *testing.T) {
+			ps, err := testPaths(t, tt.templates...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := ps.overlaps(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("overlaps = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchPrecedence(t *testing.T) {
+	ps, err := testPaths(t,
+		"people",
+		"people/me",
+		"people/{id:int}",
+		"people/{id:uuid}",
+		"people/{slug:[a-z]+-[0-9]+}",
+		"people/{name}",
+		"people/{name}/books",
+		"people/{id:int}/books/{book}",
+		"files/{rest...}",
+		"files/readme",
+		"files/{dir}/index",
+		"{any...}",
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path     string
+		template string
+		args     map[string]string
+	}{
+		{"people", "people", map[string]string{}},
+		{"PEOPLE", "people", map[string]string{}},
+		{"people/me", "people/me", map[string]string{}},
+		{"people/42", "people/{id:int}", map[string]string{"{id}": "42"}},
+		{"people/-7", "people/{id:int}", map[string]string{"{id}": "-7"}},
+		{"people/0b0b0b0b-0000-4000-8000-000000000000", "people/{id:uuid}", map[string]string{"{id}": "0b0b0b0b-0000-4000-8000-000000000000"}},
+		{"people/ann-1", "people/{slug:[a-z]+-[0-9]+}", map[string]string{"{slug}": "ann-1"}},
+		{"people/Ann", "people/{name}", map[string]string{"{name}": "Ann"}},
+		{"people/me/books", "people/{name}/books", map[string]string{"{name}": "me"}},
+		{"people/42/books", "people/{name}/books", map[string]string{"{name}": "42"}},
+		{"people/42/books/7", "people/{id:int}/books/{book}", map[string]string{"{id}": "42", "{book}": "7"}},
+		{"people/ann/books/7", "{any...}", map[string]string{"{any}": "people/ann/books/7"}},
+		{"files/readme", "files/readme", map[string]string{}},
+		{"files/docs/index", "files/{dir}/index", map[string]string{"{dir}": "docs"}},
+		{"files/docs/guide", "files/{rest...}", map[string]string{"{rest}": "docs/guide"}},
+		{"files/a/b/c", "files/{rest...}", map[string]string{"{rest}": "a/b/c"}},
+		{"files", "{any...}", map[string]string{"{any}": "files"}},
+		{"people/", "{any...}", map[string]string{"{any}": "people/"}},
+		{"other", "{any...}", map[string]string{"{any}": "other"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			match, ok := ps.MatchPath(tt.path)
+			if !ok {
+				t.Fatalf("no route for %s", tt.path)
+			}
+			if match.Template != tt.template {
+				t.Errorf("template = %s, want %s", match.Template, tt.template)
+			}
+			if !reflect.DeepEqual(match.Args, tt.args) {
+				t.Errorf("args = %v, want %v", match.Args, tt.args)
+			}
+		})
+	}
+}
+
+func TestMatchWithoutCatchAll(t *testing.T) {
+	ps, err := testPaths(t, "people", "people/{id:int}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"", "people/ann", "people/", "people/1/books", "books"} {
+		if match, ok := ps.MatchPath(path); ok {
+			t.Errorf("%q matched %s", path, match.Template)
+		}
+	}
+}
+
+func TestInvalidRoutes(t *testing.T) {
+	tests := []struct {
+		template string
+		err      string
+	}{
+		{"files/{rest...}/x", "path files/{rest...}/x: catch-all {rest...} must be the last segment"},
+		{"blog/{slug:[a-z}", "path blog/{slug:[a-z}: invalid pattern for {slug}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.template, func(t *testing.T) {
+			if _, err := testPaths(t, tt.template); err == nil || !strings.HasPrefix(err.Error(), tt.err) {
+				t.Errorf("error = %v, want %s", err, tt.err)
+			}
+		})
+	}
+}
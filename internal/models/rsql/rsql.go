@@ -0,0 +1,285 @@
+package rsql
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Comparison operators. The symbolic forms <, <=, > and >= are accepted as
+// aliases of =lt=, =le=, =gt= and =ge=.
+const (
+	Equal          = "=="
+	NotEqual       = "!="
+	Greater        = "=gt="
+	GreaterOrEqual = "=ge="
+	Less           = "=lt="
+	LessOrEqual    = "=le="
+	In             = "=in="
+	Out            = "=out="
+)
+
+var aliases = map[string]string{
+	"<":  Less,
+	"<=": LessOrEqual,
+	">":  Greater,
+	">=": GreaterOrEqual,
+}
+
+var operators = map[string]bool{
+	Equal: true, NotEqual: true, Greater: true, GreaterOrEqual: true,
+	Less: true, LessOrEqual: true, In: true, Out: true,
+}
+
+type Node interface {
+	Position() int
+}
+
+// Logical joins its children with and (;) or or (,).
+type Logical struct {
+	And      bool
+	Children []Node
+	Pos      int
+}
+
+// Comparison tests a selector against its arguments. Quoted reports, for
+// each argument, whether it was given in quotes, which makes any * in it
+// literal.
+type Comparison struct {
+	Selector string
+	Operator string
+	Args     []string
+	Quoted   []bool
+	Pos      int
+}
+
+func (l *Logical) Position() int {
+	return l.Pos
+}
+
+func (c *Comparison) Position() int {
+	return c.Pos
+}
+
+// Wildcard reports whether the i'th argument matches with * wildcards.
+func (c *Comparison) Wildcard(i int) bool {
+	return !c.Quoted[i] && strings.Contains(c.Args[i], "*")
+}
+
+// Error reports a malformed or invalid expression at a 1-based position.
+type Error struct {
+	Pos int
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s at position %d", e.Msg, e.Pos)
+}
+
+func Errorf(pos int, format string, a ...interface{}) error {
+	return &Error{Pos: pos, Msg: fmt.Sprintf(format, a...)}
+}
+
+type parser struct {
+	input string
+	pos   int
+}
+
+// Parse parses an RSQL expression such as `age=gt=30;name==j*`. A * in an
+// unquoted argument is a wildcard; in a quoted one, e.g. "5*", it is literal.
+func Parse(input string) (Node, error) {
+	p := &parser{input: input}
+	node, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.input) {
+		return nil, p.errorf("unexpected %q", p.input[p.pos])
+	}
+	return node, nil
+}
+
+func (p *parser) errorf(format string, a ...interface{}) error {
+	return Errorf(p.pos+1, format, a...)
+}
+
+func (p *parser) skipSpace() {
+	for p.pos < len(p.input) && p.input[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+func (p *parser) peek() byte {
+	p.skipSpace()
+	if p.pos < len(p.input) {
+		return p.input[p.pos]
+	}
+	return 0
+}
+
+func (p *parser) or() (Node, error) {
+	return p.logical(false, ',', p.and)
+}
+
+func (p *parser) and() (Node, error) {
+	return p.logical(true, ';', p.constraint)
+}
+
+func (p *parser) logical(and bool, separator byte, operand func() (Node, error)) (Node, error) {
+	start := p.pos + 1
+	first, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	children := []Node{first}
+	for p.peek() == separator {
+		p.pos++
+		next, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, next)
+	}
+	if len(children) == 1 {
+		return first, nil
+	}
+	return &Logical{And: and, Children: children, Pos: start}, nil
+}
+
+func (p *parser) constraint() (Node, error) {
+	if p.peek() == '(' {
+		p.pos++
+		node, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ')' {
+			return nil, p.errorf("expected ')'")
+		}
+		p.pos++
+		return node, nil
+	}
+	return p.comparison()
+}
+
+func (p *parser) comparison() (Node, error) {
+	p.skipSpace()
+	start := p.pos + 1
+	selector := p.unreserved()
+	if selector == "" {
+		if p.pos >= len(p.input) {
+			return nil, p.errorf("expected selector")
+		}
+		return nil, p.errorf("expected selector, found %q", p.input[p.pos])
+	}
+
+	opPos := p.pos
+	operator, err := p.operator()
+	if err != nil {
+		return nil, err
+	}
+
+	var args []string
+	var quoted []bool
+	if p.peek() == '(' {
+		p.pos++
+		for {
+			arg, q, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			args, quoted = append(args, arg), append(quoted, q)
+			if p.peek() == ',' {
+				p.pos++
+				continue
+			}
+			if p.peek() != ')' {
+				return nil, p.errorf("expected ',' or ')'")
+			}
+			p.pos++
+			break
+		}
+	} else {
+		arg, q, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		args, quoted = append(args, arg), append(quoted, q)
+	}
+
+	multi := operator == In || operator == Out
+	if !multi && len(args) != 1 {
+		return nil, Errorf(opPos+1, "operator %s takes a single argument", operator)
+	}
+	return &Comparison{Selector: selector, Operator: operator, Args: args, Quoted: quoted, Pos: start}, nil
+}
+
+func (p *parser) operator() (string, error) {
+	rest := p.input[p.pos:]
+	for _, symbol := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+		if strings.HasPrefix(rest, symbol) {
+			p.pos += len(symbol)
+			if alias, ok := aliases[symbol]; ok {
+				return alias, nil
+			}
+			return symbol, nil
+		}
+	}
+	if strings.HasPrefix(rest, "=") {
+		end := strings.IndexByte(rest[1:], '=')
+		if end > 0 {
+			operator := rest[:end+2]
+			if operators[operator] {
+				p.pos += len(operator)
+				return operator, nil
+			}
+			return "", p.errorf("unknown operator %s", operator)
+		}
+	}
+	if p.pos >= len(p.input) {
+		return "", p.errorf("expected operator")
+	}
+	return "", p.errorf("expected operator, found %q", p.input[p.pos])
+}
+
+// value returns the next argument and whether it was quoted.
+func (p *parser) value() (string, bool, error) {
+	p.skipSpace()
+	if p.pos < len(p.input) && (p.input[p.pos] == '"' || p.input[p.pos] == '\'') {
+		quote := p.input[p.pos]
+		start := p.pos
+		p.pos++
+		var sb strings.Builder
+		for p.pos < len(p.input) {
+			c := p.input[p.pos]
+			if c == '\\' && p.pos+1 < len(p.input) {
+				sb.WriteByte(p.input[p.pos+1])
+				p.pos += 2
+				continue
+			}
+			if c == quote {
+				p.pos++
+				return sb.String(), true, nil
+			}
+			sb.WriteByte(c)
+			p.pos++
+		}
+		return "", false, Errorf(start+1, "unterminated string")
+	}
+	value := p.unreserved()
+	if value == "" {
+		if p.pos >= len(p.input) {
+			return "", false, p.errorf("expected value")
+		}
+		return "", false, p.errorf("expected value, found %q", p.input[p.pos])
+	}
+	return value, false, nil
+}
+
+func (p *parser) unreserved() string {
+	start := p.pos
+	for p.pos < len(p.input) && !strings.ContainsRune(`"'();,=!~<> `, rune(p.input[p.pos])) {
+		p.pos++
+	}
+	return p.input[start:p.pos]
+}
@@ -0,0 +1,137 @@
+package rsql
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// format renders a node with explicit grouping and quoted arguments marked.
+func format(node Node) string {
+	switch n := node.(type) {
+	case *Logical:
+		parts := make([]string, len(n.Children))
+		for i, child := range n.Children {
+			parts[i] = format(child)
+		}
+		separator := ","
+		if n.And {
+			separator = ";"
+		}
+		return "(" + strings.Join(parts, separator) + ")"
+	case *Comparison:
+		args := make([]string, len(n.Args))
+		for i, arg := range n.Args {
+			args[i] = arg
+			if n.Quoted[i] {
+				args[i] = fmt.Sprintf("%q", arg)
+			}
+		}
+		return fmt.Sprintf("%s%s[%s]", n.Selector, n.Operator, strings.Join(args, "|"))
+	}
+	return "?"
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{`name==jo`, `name==[jo]`},
+		{`name!=jo`, `name!=[jo]`},
+		{`age=gt=30`, `age=gt=[30]`},
+		{`age=ge=30`, `age=ge=[30]`},
+		{`age=lt=30`, `age=lt=[30]`},
+		{`age=le=30`, `age=le=[30]`},
+		{`age>30`, `age=gt=[30]`},
+		{`age>=30`, `age=ge=[30]`},
+		{`age<30`, `age=lt=[30]`},
+		{`age<=30`, `age=le=[30]`},
+		{`role=in=(admin,owner)`, `role=in=[admin|owner]`},
+		{`role=out=(admin)`, `role=out=[admin]`},
+		{`role=in=admin`, `role=in=[admin]`},
+		{`name==j*`, `name==[j*]`},
+		{`name=="j*"`, `name==["j*"]`},
+		{`name=='a b'`, `name==["a b"]`},
+		{`name=="say \"hi\""`, `name==["say \"hi\""]`},
+		{`name=='it\'s'`, `name==["it's"]`},
+		{`name==""`, `name==[""]`},
+		{`role=in=("a,b",c)`, `role=in=["a,b"|c]`},
+		{`a==1;b==2`, `(a==[1];b==[2])`},
+		{`a==1,b==2`, `(a==[1],b==[2])`},
+		{`a==1;b==2,c==3`, `((a==[1];b==[2]),c==[3])`},
+		{`a==1,b==2;c==3`, `(a==[1],(b==[2];c==[3]))`},
+		{`a==1;(b==2,c==3)`, `(a==[1];(b==[2],c==[3]))`},
+		{`((a==1))`, `a==[1]`},
+		{` a==1 ; b== 2 `, `(a==[1];b==[2])`},
+		{`person.email==x@y`, `person.email==[x@y]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			node, err := Parse(tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := format(node); got != tt.want {
+				t.Errorf("Parse(%s) = %s, want %s", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		err   string
+	}{
+		{``, `expected selector at position 1`},
+		{`==1`, `expected selector, found '=' at position 1`},
+		{`name`, `expected operator at position 5`},
+		{`name~1`, `expected operator, found '~' at position 5`},
+		{`a ==1`, `expected operator, found ' ' at position 2`},
+		{`name=like=1`, `unknown operator =like= at position 5`},
+		{`name==`, `expected value at position 7`},
+		{`name==)`, `expected value, found ')' at position 7`},
+		{`name=="open`, `unterminated string at position 7`},
+		{`name==(a,b)`, `operator == takes a single argument at position 5`},
+		{`role=in=(a,b`, `expected ',' or ')' at position 13`},
+		{`(a==1`, `expected ')' at position 6`},
+		{`a==1;`, `expected selector at position 6`},
+		{`a==1)`, `unexpected ')' at position 5`},
+		{`a==1 b==2`, `unexpected 'b' at position 6`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			_, err := Parse(tt.input)
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("Parse(%s) error = %v, want %s", tt.input, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestWildcard(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []bool
+	}{
+		{`name==j*`, []bool{true}},
+		{`name=="j*"`, []bool{false}},
+		{`name==jo`, []bool{false}},
+		{`name=in=(j*,'k*',l)`, []bool{true, false, false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			node, err := Parse(tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c := node.(*Comparison)
+			for i, want := range tt.want {
+				if got := c.Wildcard(i); got != want {
+					t.Errorf("Wildcard(%d) = %t, want %t", i, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+)
+
+const (
+	kindInt   = "int"
+	kindUUID  = "uuid"
+	kindRegex = "regex"
+)
+
+var (
+	intPattern  = regexp.MustCompile(`^[+-]?[0-9]+$`)
+	uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+)
+
+// segment is one part of a route. Placeholders may be constrained by a type or
+// regular expression, and a trailing {name...} captures the rest of the path:
+//
+//	person/{id:int}  person/{id:uuid}  blog/{slug:[a-z0-9-]+}  files/{rest...}
+type segment struct {
+	literal  string
+	param    string
+	kind     string
+	pattern  *regexp.Regexp
+	catchAll bool
+}
+
+func parseSegment(part string) (*segment, error) {
+	if !strings.HasPrefix(part, "{") || !strings.HasSuffix(part, "}") {
+		return &segment{literal: lower.String(part)}, nil
+	}
+	inner := part[1 : len(part)-1]
+	if strings.HasSuffix(inner, "...") {
+		return &segment{param: inner[:len(inner)-3], catchAll: true}, nil
+	}
+	name, spec, constrained := strings.Cut(inner, ":")
+	s := &segment{param: name}
+	if !constrained {
+		return s, nil
+	}
+	switch lower.String(spec) {
+	case kindInt:
+		s.kind, s.pattern = kindInt, intPattern
+	case kindUUID:
+		s.kind, s.pattern = kindUUID, uuidPattern
+	default:
+		pattern, err := regexp.Compile(fmt.Sprintf("^(?:%s)$", spec))
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern for {%s}: %w", name, err)
+		}
+		s.kind, s.pattern = kindRegex, pattern
+	}
+	return s, nil
+}
+
+func (s *segment) isParam() bool {
+	return s.param != ""
+}
+
+func (s *segment) accepts(value string) bool {
+	if !s.isParam() {
+		return strings.EqualFold(s.literal, value)
+	}
+	return s.pattern == nil || s.pattern.MatchString(value)
+}
+
+func (s *segment) placeholder() string {
+	return fmt.Sprintf("{%s}", s.param)
+}
+
+// constraint identifies placeholders that accept exactly the same values.
+func (s *segment) constraint() string {
+	if s.pattern == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s:%s", s.kind, s.pattern.String())
+}
+
+// precedes orders placeholders so that typed constraints are tried before
+// patterns, and patterns before unconstrained placeholders.
+func (s *segment) precedes(other *segment) bool {
+	rank := func(seg *segment) int {
+		switch seg.kind {
+		case kindInt:
+			return 0
+		case kindUUID:
+			return 1
+		case kindRegex:
+			return 2
+		}
+		return 3
+	}
+	if rank(s) != rank(other) {
+		return rank(s) < rank(other)
+	}
+	return s.constraint() < other.constraint()
+}
+
+// sample returns a value the segment accepts.
+func (s *segment) sample() string {
+	switch {
+	case !s.isParam():
+		return s.literal
+	case s.catchAll:
+		return "x"
+	case s.kind == kindInt:
+		return "1"
+	case s.kind == kindUUID:
+		return "00000000-0000-0000-0000-000000000000"
+	case s.pattern != nil:
+		if re, err := syntax.Parse(s.pattern.String(), syntax.Perl); err == nil {
+			if value := shortest(re); value != "" && s.accepts(value) {
+				return value
+			}
+		}
+	}
+	return "x"
+}
+
+// shared returns a value that both segments accept, trying a sample of each.
+func (s *segment) shared(other *segment) (string, bool) {
+	for _, value := range []string{s.sample(), other.sample()} {
+		if s.accepts(value) && other.accepts(value) {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// shortest returns one of the shortest strings matched by a regular
+// expression.
+func shortest(re *syntax.Regexp) string {
+	switch re.Op {
+	case syntax.OpLiteral:
+		return string(re.Rune)
+	case syntax.OpCharClass:
+		if len(re.Rune) > 0 {
+			return string(re.Rune[0])
+		}
+	case syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		return "x"
+	case syntax.OpCapture:
+		return shortest(re.Sub[0])
+	case syntax.OpPlus:
+		return shortest(re.Sub[0])
+	case syntax.OpRepeat:
+		return strings.Repeat(shortest(re.Sub[0]), re.Min)
+	case syntax.OpConcat:
+		var sb strings.Builder
+		for _, sub := range re.Sub {
+			sb.WriteString(shortest(sub))
+		}
+		return sb.String()
+	case syntax.OpAlternate:
+		return shortest(re.Sub[0])
+	}
+	return ""
+}
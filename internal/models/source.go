@@ -1,68 +1,94 @@
 package models
 
 import (
-	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"jrest/internal/handlers"
+	"jrest/internal/logging"
 	"jrest/internal/security"
 	"log"
+	"os"
 	"reflect"
 	"strconv"
 	"strings"
 
 	"github.com/hashicorp/go-memdb"
-	"gopkg.in/yaml.v3"
 )
 
+const (
+	ActionReplace    = "replace"
+	ActionPatch      = "patch"
+	ActionMergePatch = "merge_patch"
+	ActionJSONPatch  = "json_patch"
+)
+
+// MethodAny serves any method that a path does not list explicitly.
+const MethodAny = "ANY"
+
 type Source struct {
-	Host           string          `json:"host" yaml:"host" default:"127.0.0.1"`
-	Base           string          `json:"base" yaml:"base" default:"/"`
-	Port           int             `json:"port" yaml:"port" default:"8080"`
-	Timeout        int             `json:"timeout" yaml:"timeout" default:"30"`
-	TLS            *Tls            `json:"tls,omitempty" yaml:"tls,omitempty"`
-	Authentication *Authentication `json:"auth,omitempty" yaml:"auth,omitempty"`
-	Paths          Paths           `json:"paths" yaml:"paths"`
-	Storage        *Store          `json:"storage,omitempty" yaml:"storage,omitempty"`
-}
-type Tls struct {
-	CertFile string `json:"certFile" yaml:"certFile"`
-	KeyFile  string `json:"keyFile" yaml:"keyFile"`
+	Host           string               `json:"host" yaml:"host" default:"127.0.0.1"`
+	Base           string               `json:"base" yaml:"base" default:"/"`
+	Port           int                  `json:"port" yaml:"port" default:"8080"`
+	Timeout        int                  `json:"timeout" yaml:"timeout" default:"30"`
+	Log            *Logging             `json:"log,omitempty" yaml:"log,omitempty"`
+	TLS            *Tls                 `json:"tls,omitempty" yaml:"tls,omitempty"`
+	Authentication *Authentication      `json:"auth,omitempty" yaml:"auth,omitempty"`
+	Cors           *Cors                `json:"cors,omitempty" yaml:"cors,omitempty"`
+	Paths          Paths                `json:"paths" yaml:"paths"`
+	Resources      map[string]*Resource `json:"resources,omitempty" yaml:"resources,omitempty"`
+	Storage        *Store               `json:"storage,omitempty" yaml:"storage,omitempty"`
 }
 type Authentication struct {
-	Bearer      security.Claims `json:"bearer,omitempty" yaml:"bearer"`
-	Credentials security.Claims `json:"credentials,omitempty" yaml:"credentials"`
+	Bearer       security.Claims       `json:"bearer,omitempty" yaml:"bearer"`
+	Credentials  *security.Credentials `json:"credentials,omitempty" yaml:"credentials"`
+	ApiKey       *security.ApiKey      `json:"apikey,omitempty" yaml:"apikey"`
+	ClientCert   *security.ClientCert  `json:"mtls,omitempty" yaml:"mtls"`
+	Any          []*Authentication     `json:"any,omitempty" yaml:"any,omitempty"`
+	All          []*Authentication     `json:"all,omitempty" yaml:"all,omitempty"`
+	Public       bool                  `json:"public,omitempty" yaml:"public,omitempty"`
+	Realm        string                `json:"realm,omitempty" yaml:"realm,omitempty"`
+	Unauthorized *ErrorResponse        `json:"unauthorized,omitempty" yaml:"unauthorized,omitempty"`
+	Forbidden    *ErrorResponse        `json:"forbidden,omitempty" yaml:"forbidden,omitempty"`
 }
-type Paths struct {
-	audit   []string
-	dynamic []*PathMeta
-	static  map[string]*Path
+type Logging struct {
+	Format string `json:"format,omitempty" yaml:"format,omitempty"`
+	Level  string `json:"level,omitempty" yaml:"level,omitempty"`
 }
-type PathMeta struct {
-	parts     []string
-	arguments map[int]string
-	path      *Path
+type ErrorResponse struct {
+	Status  int               `json:"status_code,omitempty" yaml:"status_code,omitempty"`
+	Content *string           `json:"content,omitempty" yaml:"content,omitempty"`
+	Headers map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`
 }
 type Path struct {
 	Authentication *Authentication `json:"auth,omitempty" yaml:"auth,omitempty"`
+	Cors           *Cors           `json:"cors,omitempty" yaml:"cors,omitempty"`
 	Methods        Methods         `json:"methods" yaml:"methods"`
 }
 type Methods map[string]*Response
 type Response struct {
 	Authentication *Authentication   `json:"auth,omitempty" yaml:"auth,omitempty"`
+	Cors           *Cors             `json:"cors,omitempty" yaml:"cors,omitempty"`
 	Status         int               `json:"status_code,omitempty" yaml:"status_code,omitempty"`
 	Content        *string           `json:"content" yaml:"content"`
 	Headers        map[string]string `json:"headers,omitempty" yaml:"headers"`
 	Select         *Query            `json:"select" yaml:"select"`
 	Insert         *Query            `json:"insert" yaml:"insert"`
+	Update         *Query            `json:"update" yaml:"update"`
 	Delete         *Query            `json:"delete" yaml:"delete"`
 }
 type Query struct {
-	Action   string  `json:"action" yaml:"action"`
-	Entity   string  `json:"entity" yaml:"entity"`
-	Filter   *Filter `json:"filter,omitempty" yaml:"filter,omitempty"`
-	Page     *int    `json:"page,omitempty" yaml:"page,omitempty"`
-	PageSize *int    `json:"page_size,omitempty" yaml:"page_size,omitempty"`
+	Action      string            `json:"action" yaml:"action"`
+	Entity      string            `json:"entity" yaml:"entity"`
+	Filter      *Filter           `json:"filter,omitempty" yaml:"filter,omitempty"`
+	Values      map[string]string `json:"values,omitempty" yaml:"values,omitempty"`
+	QueryParams bool              `json:"query_params,omitempty" yaml:"query_params,omitempty"`
+	Rsql        string            `json:"rsql,omitempty" yaml:"rsql,omitempty"`
+	Single      bool              `json:"single,omitempty" yaml:"single,omitempty"`
+	NotFound    *ErrorResponse    `json:"not_found,omitempty" yaml:"not_found,omitempty"`
+	Multiple    *ErrorResponse    `json:"multiple,omitempty" yaml:"multiple,omitempty"`
+	Expand      []string          `json:"expand,omitempty" yaml:"expand,omitempty"`
+	ExpandParam bool              `json:"expand_param,omitempty" yaml:"expand_param,omitempty"`
+	Page        *int              `json:"page,omitempty" yaml:"page,omitempty"`
+	PageSize    *int              `json:"page_size,omitempty" yaml:"page_size,omitempty"`
 }
 type Filter struct {
 	Index  *string  `json:"index,omitempty" yaml:"index,omitempty"`
@@ -102,45 +128,209 @@ func (s *Source) Cleanse() {
 	}
 }
 
+// Logger returns the request logger, writing text records at info level
+// unless configured otherwise.
+func (s *Source) Logger() (*logging.Logger, error) {
+	format, level := logging.FormatText, logging.LevelInfo
+	if s.Log != nil {
+		if s.Log.Format != "" {
+			format = s.Log.Format
+		}
+		if s.Log.Level != "" {
+			var err error
+			if level, err = logging.ParseLevel(s.Log.Level); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return logging.New(os.Stderr, format, level)
+}
+
 func (s *Source) LogPaths() {
 	for _, api := range s.Paths.audit {
 		log.Printf("%s\n", api)
 	}
+	for _, overlap := range s.Paths.overlaps() {
+		log.Printf("%s\n", overlap)
+	}
+}
+
+// LoadFiles reads any files referenced by the source, such as htpasswd files,
+// relative to dir and returns their names so that they can be watched. The
+// persistence snapshot is located relative to dir too, but is not watched.
+func (s *Source) LoadFiles(dir string) ([]string, error) {
+	var loaders []fileLoader
+	for _, auth := range s.authentications() {
+		if err := auth.validate(); err != nil {
+			return nil, err
+		}
+		loaders = append(loaders, auth.loaders()...)
+	}
+	if s.TLS != nil && s.TLS.Mtls != nil {
+		loaders = append(loaders, s.TLS.Mtls)
+	}
+	if s.Storage != nil {
+		for _, name := range sortedNames(s.Storage.Entities) {
+			if entity := s.Storage.Entities[name]; entity != nil && entity.DataFile != nil {
+				loaders = append(loaders, entity.DataFile)
+			}
+		}
+	}
+
+	var files []string
+	for _, loader := range loaders {
+		filename, err := loader.Load(dir)
+		if err != nil {
+			return nil, err
+		}
+		if filename != "" {
+			files = append(files, filename)
+		}
+	}
+	if s.Storage != nil && s.Storage.Persist != nil {
+		s.Storage.Persist.resolve(dir)
+	}
+	return files, nil
+}
+
+type fileLoader interface {
+	Load(dir string) (string, error)
+}
+
+func (a *Authentication) loaders() []fileLoader {
+	var loaders []fileLoader
+	if a.Credentials != nil {
+		loaders = append(loaders, a.Credentials)
+	}
+	if a.ApiKey != nil {
+		loaders = append(loaders, a.ApiKey)
+	}
+	return loaders
+}
+
+func (s *Source) authentications() []*Authentication {
+	auths := s.Authentication.flatten()
+	for _, path := range s.Paths.All() {
+		auths = append(auths, path.Authentication.flatten()...)
+		for _, response := range path.Methods {
+			if response != nil {
+				auths = append(auths, response.Authentication.flatten()...)
+			}
+		}
+	}
+	return auths
 }
 
-func (s *Source) ConfigureMemDB() {
-	if s.Storage == nil || len(s.Storage.Entities) == 0 {
+// validate rejects a block that names no way to authenticate, which would
+// otherwise let every caller in. Only public opens a path.
+func (a *Authentication) validate() error {
+	if a.Public {
+		return nil
+	}
+	for _, sub := range append(a.Any, a.All...) {
+		if sub == nil {
+			return errors.New("authentication: empty any or all entry")
+		}
+	}
+	if a.Bearer == nil && a.Credentials == nil && a.ApiKey == nil && a.ClientCert == nil &&
+		len(a.Any) == 0 && len(a.All) == 0 {
+		return errors.New("authentication: no scheme, any or all given, set public: true to open a path")
+	}
+	return nil
+}
+
+func (a *Authentication) flatten() []*Authentication {
+	if a == nil {
+		return nil
+	}
+	auths := []*Authentication{a}
+	for _, sub := range a.Any {
+		auths = append(auths, sub.flatten()...)
+	}
+	for _, sub := range a.All {
+		auths = append(auths, sub.flatten()...)
+	}
+	return auths
+}
+
+// ConfigureMemDB creates the database and loads the source data into it. On a
+// reload the previous database is kept when the schema is unchanged, or else
+// its rows are migrated, so the source data only seeds new entities and those
+// whose data has changed.
+func (s *Source) ConfigureMemDB(previous *Store) error {
+	if s.Storage == nil {
+		return nil
+	}
+	if len(s.Storage.Entities) == 0 {
 		s.Storage.DB = nil
-		return
+		return nil
+	}
+	for entityName := range s.Storage.Data {
+		if _, ok := s.Storage.Entities[entityName]; !ok {
+			return fmt.Errorf("unknown data entity: %s", entityName)
+		}
+	}
+	for _, name := range sortedNames(s.Storage.Entities) {
+		if err := s.Storage.Entities[name].checkVersion(name); err != nil {
+			return err
+		}
+	}
+	if err := s.Storage.relate(); err != nil {
+		return err
+	}
+	// The previous database is left as it is until the source is swapped in.
+	reload := previous != nil && previous.DB != nil
+	if reload && previous.schema() == s.Storage.schema() {
+		names, err := s.Storage.reseeds(previous)
+		if err != nil {
+			return err
+		}
+		s.Storage.DB = previous.DB
+		if len(names) > 0 {
+			s.Storage.DB = previous.DB.Snapshot()
+		}
+		s.Storage.changed()
+		return s.Storage.reseed(names)
 	}
 
 	// Create a new database
 	var err error
 	s.Storage.DB, err = memdb.NewMemDB(s.Storage.buildSchema())
 	if err != nil {
-		log.Fatalf("Unable to start database: %v", err)
-		return
+		return fmt.Errorf("unable to start database: %w", err)
+	}
+	if reload {
+		if err = s.Storage.migrate(previous); err != nil {
+			return err
+		}
+		s.Storage.replaced()
+		names, err := s.Storage.reseeds(previous)
+		if err != nil {
+			return err
+		}
+		s.Storage.changed()
+		return s.Storage.reseed(names)
+	}
+
+	if s.Storage.Persist != nil {
+		restored, err := s.Storage.restore()
+		if err != nil {
+			return fmt.Errorf("unable to restore database: %w", err)
+		}
+		if restored {
+			return nil
+		}
 	}
 
 	// Load test data
-	if s.Storage.Data != nil {
+	if s.Storage.seeded() {
 		// Create a writeable transaction
 		txn := s.Storage.DB.Txn(true)
 		defer txn.Abort()
 
-		for entityName, rows := range s.Storage.Data {
-			for _, row := range rows {
-				entity, ok := s.Storage.Entities[entityName]
-				if !ok {
-					log.Fatalf("unknown data entity: %s", entityName)
-					return
-				}
-				table := entity.Table
-				instance := table.getInstance()
-				entry := table.setValues(instance, row).Interface()
-				if err = txn.Insert(entityName, entry); err != nil {
-					panic(err)
-				}
+		for _, entityName := range sortedNames(s.Storage.Entities) {
+			if err = s.Storage.seed(txn, entityName); err != nil {
+				return err
 			}
 		}
 
@@ -186,104 +376,9 @@ func (s *Source) ConfigureMemDB() {
 		//	fmt.Printf("  %-8s%v\n", fmt.Sprintf("%s:", p["Name"]), p["Age"])
 		//}
 	}
-}
-
-func (ps *Paths) MatchPath(ctx context.Context, path string) (*Path, bool) {
-	attr := ctx.Value(handlers.Attributes).(map[string]interface{})
-	p, ok := ps.static[path]
-	if ok {
-		attr[handlers.AttrPathArgs] = make(map[string]string)
-		return p, true
-	}
-
-	parts := strings.Split(path, "/")
-next:
-	for _, pathMeta := range ps.dynamic {
-		if len(pathMeta.parts) != len(parts) {
-			continue
-		}
-		arguments := make(map[string]string)
-		for index, part := range pathMeta.parts {
-			name, found := pathMeta.arguments[index]
-			if found {
-				arguments[fmt.Sprintf("{%s}", name)] = parts[index]
-				continue
-			}
-			if !strings.EqualFold(part, parts[index]) {
-				continue next
-			}
-		}
-		// matched
-		attr[handlers.AttrPathArgs] = arguments
-		return pathMeta.path, true
-	}
-	// check dynamic content
-	return nil, false
-}
-
-func (ps *Paths) UnmarshalYAML(value *yaml.Node) error {
-	ps.audit = []string{}
-	ps.static = make(map[string]*Path)
-	ps.dynamic = make([]*PathMeta, 0)
-	for index := 0; index < len(value.Content); index += 2 {
-		name := lower.String(value.Content[index].Value)
-		if strings.HasPrefix(name, "/") {
-			name = name[1:]
-		}
-		path := &Path{}
-		err := value.Content[index+1].Decode(path)
-		if err != nil {
-			return err
-		}
-		ps.processPath(name, path)
-	}
 	return nil
 }
 
-func (ps *Paths) UnmarshalJSON(data []byte) error {
-	ps.audit = []string{}
-	ps.static = make(map[string]*Path)
-	ps.dynamic = make([]*PathMeta, 0)
-	tmp := make(map[string]*Path)
-	err := json.Unmarshal(data, &tmp)
-	if err != nil {
-		return err
-	}
-	for name, path := range tmp {
-		name = lower.String(name)
-		if strings.HasPrefix(name, "/") {
-			name = name[1:]
-		}
-		ps.processPath(name, path)
-	}
-	return nil
-}
-
-func (ps *Paths) processPath(name string, path *Path) {
-	if strings.Contains(name, "{") {
-		ps.dynamic = append(ps.dynamic, newPathMeta(name, path))
-	} else {
-		ps.static[name] = path
-	}
-	for method := range path.Methods {
-		ps.audit = append(ps.audit, fmt.Sprintf("  %-6s %s", fmt.Sprintf("%s:", method), name))
-	}
-}
-
-func newPathMeta(name string, path *Path) *PathMeta {
-	meta := &PathMeta{
-		parts:     strings.Split(name, "/"),
-		arguments: make(map[int]string),
-		path:      path,
-	}
-	for index, part := range meta.parts {
-		if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") {
-			meta.arguments[index] = part[1 : len(part)-1]
-		}
-	}
-	return meta
-}
-
 func atoi(val string) int {
 	i, err := strconv.Atoi(val)
 	if err != nil {
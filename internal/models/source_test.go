@@ -0,0 +1,102 @@
+package models
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+const seededPeople = `
+storage:
+  entities:
+    person:
+      fields: {id: Int, name: String%s}
+      indexes: {id: {field: id, unique: true}}
+  data:
+    person:
+      - {id: 1, name: %s}
+`
+
+func TestReloadLeavesPreviousStore(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields string
+	}{
+		{"reseed", ""},
+		{"migrate", ", age: Int"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			previous := testSource(t, fmt.Sprintf(seededPeople, "", "ann")).Storage
+			source := &Source{}
+			if err := yaml.Unmarshal([]byte(fmt.Sprintf(seededPeople, tt.fields, "bob")), source); err != nil {
+				t.Fatal(err)
+			}
+			if err := source.ConfigureMemDB(previous); err != nil {
+				t.Fatal(err)
+			}
+			if source.Storage.DB == previous.DB {
+				t.Fatal("the reloaded store shares the previous database")
+			}
+			query := &Query{Entity: "person"}
+			if rows := selectRows(t, previous, query, ""); len(rows) != 1 || rows[0]["Name"] != "ann" {
+				t.Errorf("previous rows = %v, want ann", rows)
+			}
+			if rows := selectRows(t, source.Storage, query, ""); len(rows) != 1 || rows[0]["Name"] != "bob" {
+				t.Errorf("reloaded rows = %v, want bob", rows)
+			}
+		})
+	}
+}
+
+func TestRewriteAfterReload(t *testing.T) {
+	tests := []struct {
+		name    string
+		fields  string
+		seed    string
+		rewrite bool
+	}{
+		{"unchanged", "", "ann", false},
+		{"reseed", "", "bob", true},
+		{"migrate", ", age: Int", "ann", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			previous := testSource(t, fmt.Sprintf(seededPeople, "", "ann")).Storage
+			source := &Source{}
+			if err := yaml.Unmarshal([]byte(fmt.Sprintf(seededPeople, tt.fields, tt.seed)), source); err != nil {
+				t.Fatal(err)
+			}
+			source.Storage.Persist = &Persist{File: "state.json", Log: true}
+			source.Storage.Persist.resolve(dir)
+			if err := os.WriteFile(source.Storage.Persist.logPath(), []byte(`{"op":"put","entity":"person","row":{"id":9}}`+"\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := source.ConfigureMemDB(previous); err != nil {
+				t.Fatal(err)
+			}
+			if err := source.Storage.StartPersist(); err != nil {
+				t.Fatal(err)
+			}
+			defer source.Storage.StopPersist()
+			if err := source.Storage.Rewrite(); err != nil {
+				t.Fatal(err)
+			}
+
+			info, err := os.Stat(source.Storage.Persist.logPath())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if emptied := info.Size() == 0; emptied != tt.rewrite {
+				t.Errorf("change log emptied = %t, want %t", emptied, tt.rewrite)
+			}
+			if _, err = os.Stat(filepath.Join(dir, "state.json")); (err == nil) != tt.rewrite {
+				t.Errorf("snapshot written = %t, want %t", err == nil, tt.rewrite)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package models
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+var clientAuthModes = map[string]tls.ClientAuthType{
+	"none":            tls.NoClientCert,
+	"request":         tls.RequestClientCert,
+	"require_any":     tls.RequireAnyClientCert,
+	"verify_if_given": tls.VerifyClientCertIfGiven,
+	"require":         tls.RequireAndVerifyClientCert,
+}
+
+// Tls serves the source over https. The client CA bundle is read again when
+// the source is reloaded; the certificate and key are read only at startup.
+type Tls struct {
+	CertFile string `json:"certFile" yaml:"certFile"`
+	KeyFile  string `json:"keyFile" yaml:"keyFile"`
+	Mtls     *Mtls  `json:"mtls,omitempty" yaml:"mtls,omitempty"`
+}
+type Mtls struct {
+	CAFile string `json:"caFile" yaml:"caFile"`
+	Mode   string `json:"mode,omitempty" yaml:"mode,omitempty"`
+	pool   *x509.CertPool
+}
+
+// Load reads the client CA bundle, relative to dir, and returns its name.
+func (m *Mtls) Load(dir string) (string, error) {
+	if m.CAFile == "" {
+		return "", nil
+	}
+	filename := m.CAFile
+	if !filepath.IsAbs(filename) {
+		filename = filepath.Join(dir, filename)
+	}
+	bs, err := os.ReadFile(filename)
+	if err != nil {
+		return "", fmt.Errorf("unable to read client CA bundle %s: %w", m.CAFile, err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(bs) {
+		return "", fmt.Errorf("no certificates found in client CA bundle %s", m.CAFile)
+	}
+	m.pool = pool
+	return filename, nil
+}
+
+// Config builds the server TLS configuration, requesting client certificates
+// when mtls is configured. Mode defaults to require, which verifies the
+// presented certificate against the client CA bundle.
+func (t *Tls) Config() (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if t.Mtls == nil {
+		return config, nil
+	}
+
+	mode := t.Mtls.Mode
+	if mode == "" {
+		mode = "require"
+	}
+	clientAuth, ok := clientAuthModes[mode]
+	if !ok {
+		return nil, fmt.Errorf("unknown mtls mode: %s", mode)
+	}
+	config.ClientAuth = clientAuth
+
+	if t.Mtls.CAFile == "" {
+		if clientAuth == tls.VerifyClientCertIfGiven || clientAuth == tls.RequireAndVerifyClientCert {
+			return nil, fmt.Errorf("mtls mode %s requires a caFile", mode)
+		}
+		return config, nil
+	}
+	if t.Mtls.pool == nil {
+		if _, err := t.Mtls.Load(""); err != nil {
+			return nil, err
+		}
+	}
+	config.ClientCAs = t.Mtls.pool
+	return config, nil
+}
@@ -0,0 +1,101 @@
+package security
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const defaultApiKeyHeader = "X-API-Key"
+
+// ApiKey configures API key authentication. The key is read from a header,
+// query parameter or cookie and looked up in Keys or the key file, each key
+// mapping to the claims attached to the caller.
+type ApiKey struct {
+	Header string            `json:"header,omitempty" yaml:"header,omitempty"`
+	Query  string            `json:"query,omitempty" yaml:"query,omitempty"`
+	Cookie string            `json:"cookie,omitempty" yaml:"cookie,omitempty"`
+	Keys   map[string]Claims `json:"keys,omitempty" yaml:"keys,omitempty"`
+	File   string            `json:"file,omitempty" yaml:"file,omitempty"`
+	Claims Claims            `json:"claims,omitempty" yaml:"claims,omitempty"`
+	file   map[string]Claims
+}
+
+// Load reads the key file, if any, resolving it relative to dir. The resolved
+// filename is returned so that it can be watched for changes.
+func (k *ApiKey) Load(dir string) (string, error) {
+	if k.File == "" {
+		return "", nil
+	}
+	filename := k.File
+	if !filepath.IsAbs(filename) {
+		filename = filepath.Join(dir, filename)
+	}
+	bs, err := os.ReadFile(filename)
+	if err != nil {
+		return filename, fmt.Errorf("unable to read api key file %s: %w", filename, err)
+	}
+	keys := make(map[string]Claims)
+	if filepath.Ext(filename) == ".json" {
+		err = json.Unmarshal(bs, &keys)
+	} else {
+		err = yaml.Unmarshal(bs, &keys)
+	}
+	if err != nil {
+		return filename, fmt.Errorf("unable to parse api key file %s: %w", filename, err)
+	}
+	k.file = keys
+	return filename, nil
+}
+
+func (k *ApiKey) extract(r *http.Request) string {
+	if k.Header != "" {
+		if key := r.Header.Get(k.Header); key != "" {
+			return key
+		}
+	}
+	if k.Query != "" {
+		if key := r.URL.Query().Get(k.Query); key != "" {
+			return key
+		}
+	}
+	if k.Cookie != "" {
+		if cookie, err := r.Cookie(k.Cookie); err == nil && cookie.Value != "" {
+			return cookie.Value
+		}
+	}
+	if k.Header == "" && k.Query == "" && k.Cookie == "" {
+		return r.Header.Get(defaultApiKeyHeader)
+	}
+	return ""
+}
+
+func (k *ApiKey) lookup(key string) (Claims, bool) {
+	if claims, ok := k.Keys[key]; ok {
+		return claims, true
+	}
+	claims, ok := k.file[key]
+	return claims, ok
+}
+
+func (k *ApiKey) Authorized(r *http.Request) (Claims, error) {
+	key := strings.TrimSpace(k.extract(r))
+	if key == "" {
+		return Claims{}, fmt.Errorf("api key %w", ErrMissing)
+	}
+	keyClaims, ok := k.lookup(key)
+	if !ok {
+		return Claims{}, fmt.Errorf("unknown api key")
+	}
+
+	claims := make(Claims, len(keyClaims))
+	for name, value := range keyClaims {
+		claims[name] = value
+	}
+	return claims, forbidden(validate(k.Claims, claims))
+}
@@ -1,12 +1,10 @@
 package security
 
 import (
-	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
-	"reflect"
 	"strings"
 
 	"gopkg.in/square/go-jose.v2"
@@ -137,90 +135,22 @@ func verifyToken(bearerToken string) (map[string]interface{}, error) {
 	return claims, nil
 }
 
-func extractCredentials(credentials string) (map[string]interface{}, error) {
-	bs, err := base64.URLEncoding.DecodeString(credentials)
-	if err != nil {
-		return nil, fmt.Errorf("unable to decode credentials: %w", err)
-	}
-
-	parts := strings.SplitN(string(bs), ":", 2)
-	claims := make(map[string]interface{})
-	claims["username"] = parts[0]
-	if len(parts) > 1 {
-		claims["password"] = parts[1]
-		claims[parts[0]] = parts[1]
-	} else {
-		claims["password"] = ""
-		claims[parts[0]] = ""
-	}
-
-	return claims, nil
-}
-
-func BearerAuthorized(r *http.Request, checks Claims) (bool, Claims) {
+func BearerAuthorized(r *http.Request, checks Claims) (Claims, error) {
 	auth := r.Header.Get("Authorization")
 	if auth == "" || !strings.HasPrefix(auth, "Bearer ") {
-		return false, Claims{}
+		return Claims{}, fmt.Errorf("bearer token %w", ErrMissing)
 	}
 	claims, err := verifyToken(auth[7:])
 	if err != nil {
-		return false, Claims{}
+		return Claims{}, err
 	}
 
-	return validate(checks, claims), claims
-}
-
-func CredentialsAuthorized(r *http.Request, checks Claims) (bool, Claims) {
-	auth := r.Header.Get("Authorization")
-	if auth == "" || !strings.HasPrefix(auth, "Basic ") {
-		return false, Claims{}
-	}
-
-	claims, err := extractCredentials(auth[6:])
-	if err != nil {
-		return false, Claims{}
-	}
-
-	return validate(checks, claims), claims
-}
-
-func validate(checks Claims, claims Claims) bool {
-	for key, expected := range checks {
-		actual, ok := claims[key]
-		if !ok {
-			return false
-		}
-		te := reflect.TypeOf(expected)
-		ta := reflect.TypeOf(actual)
-		if te.Kind() != ta.Kind() {
-			return false
-		}
-		switch ev := expected.(type) {
-		case string:
-			if expected.(string) != actual.(string) {
-				return false
-			}
-		case []interface{}:
-			av := openArray(actual.([]interface{}))
-			if len(ev) == 0 {
-				return false
-			}
-			for _, v := range ev {
-				if !av.contains(v) {
-					return false
-				}
-			}
-		default:
-			fmt.Printf("Other: %v", ev)
-			return false
-		}
-	}
-	return true
+	return claims, forbidden(validate(checks, claims))
 }
 
 func (o openArray) contains(v interface{}) bool {
 	for _, a := range o {
-		if a == v {
+		if equals(a, v) {
 			return true
 		}
 	}
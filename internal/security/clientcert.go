@@ -0,0 +1,87 @@
+package security
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+)
+
+// ClientCert authorises requests on the TLS client certificate presented by
+// the caller. The certificate is exposed as claims, e.g.
+//
+//	subject: {cn, o, ou, c, l, st, dn}
+//	issuer:  {cn, o, ou, c, l, st, dn}
+//	sans:    {dns, email, uri, ip}
+//	serial, fingerprint
+//
+// so rules such as `subject.cn: {glob: "*.partner.com"}` can be applied.
+type ClientCert struct {
+	Claims          Claims `json:"claims,omitempty" yaml:"claims,omitempty"`
+	AllowUnverified bool   `json:"allow_unverified,omitempty" yaml:"allow_unverified,omitempty"`
+}
+
+func (c *ClientCert) Authorized(r *http.Request) (Claims, error) {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return Claims{}, fmt.Errorf("client certificate %w", ErrMissing)
+	}
+	if len(r.TLS.VerifiedChains) == 0 && !c.AllowUnverified {
+		return Claims{}, fmt.Errorf("client certificate was not verified")
+	}
+
+	claims := certificateClaims(r.TLS.PeerCertificates[0])
+	return claims, forbidden(validate(c.Claims, claims))
+}
+
+func certificateClaims(cert *x509.Certificate) Claims {
+	sans := map[string]interface{}{
+		"dns":   stringList(cert.DNSNames),
+		"email": stringList(cert.EmailAddresses),
+	}
+	uris := make([]string, 0, len(cert.URIs))
+	for _, uri := range cert.URIs {
+		uris = append(uris, uri.String())
+	}
+	sans["uri"] = stringList(uris)
+	ips := make([]string, 0, len(cert.IPAddresses))
+	for _, ip := range cert.IPAddresses {
+		ips = append(ips, ip.String())
+	}
+	sans["ip"] = stringList(ips)
+
+	return Claims{
+		"sub":         cert.Subject.CommonName,
+		"subject":     nameClaims(cert.Subject),
+		"issuer":      nameClaims(cert.Issuer),
+		"sans":        sans,
+		"serial":      cert.SerialNumber.String(),
+		"fingerprint": fingerprint(cert),
+	}
+}
+
+func nameClaims(name pkix.Name) map[string]interface{} {
+	return map[string]interface{}{
+		"cn": name.CommonName,
+		"o":  stringList(name.Organization),
+		"ou": stringList(name.OrganizationalUnit),
+		"c":  stringList(name.Country),
+		"l":  stringList(name.Locality),
+		"st": stringList(name.Province),
+		"dn": name.String(),
+	}
+}
+
+func fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+func stringList(values []string) []interface{} {
+	list := make([]interface{}, len(values))
+	for i, v := range values {
+		list[i] = v
+	}
+	return list
+}
@@ -0,0 +1,196 @@
+package security
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Credentials configures basic authentication. Passwords may be plaintext or
+// any hash understood by verifyPassword, and may additionally be loaded from
+// an Apache htpasswd file. For compatibility a bare map of user: password
+// pairs is accepted in place of the structured form. Every user must have a
+// password.
+type Credentials struct {
+	Users    map[string]string `json:"users,omitempty" yaml:"users,omitempty"`
+	Htpasswd string            `json:"htpasswd,omitempty" yaml:"htpasswd,omitempty"`
+	Claims   Claims            `json:"claims,omitempty" yaml:"claims,omitempty"`
+	file     map[string]string
+}
+
+var credentialKeys = map[string]bool{"users": true, "htpasswd": true, "claims": true}
+
+func (c *Credentials) UnmarshalYAML(value *yaml.Node) error {
+	tmp := make(map[string]interface{})
+	if err := value.Decode(&tmp); err != nil {
+		return err
+	}
+	return c.fromMap(tmp)
+}
+
+func (c *Credentials) UnmarshalJSON(data []byte) error {
+	tmp := make(map[string]interface{})
+	if err := json.Unmarshal(data, &tmp); err != nil {
+		return err
+	}
+	return c.fromMap(tmp)
+}
+
+func (c *Credentials) fromMap(m map[string]interface{}) error {
+	*c = Credentials{
+		Users:  make(map[string]string),
+		Claims: make(Claims),
+	}
+	structured := false
+	for key := range m {
+		if credentialKeys[key] {
+			structured = true
+		}
+	}
+	if !structured {
+		for user, value := range m {
+			password, ok := value.(string)
+			if !ok || password == "" {
+				return fmt.Errorf("credentials user %s must have a password", user)
+			}
+			c.Users[user] = password
+		}
+		return c.validate()
+	}
+
+	for key, value := range m {
+		switch key {
+		case "users":
+			users, ok := asMap(value)
+			if !ok {
+				return fmt.Errorf("credentials users must be a map of user: password")
+			}
+			for user, password := range users {
+				if password == nil || password == "" {
+					return fmt.Errorf("credentials user %s must have a password", user)
+				}
+				c.Users[user] = fmt.Sprint(password)
+			}
+		case "htpasswd":
+			c.Htpasswd = fmt.Sprint(value)
+		case "claims":
+			claims, ok := asMap(value)
+			if !ok {
+				return fmt.Errorf("credentials claims must be a map")
+			}
+			c.Claims = claims
+		default:
+			return fmt.Errorf("unknown credentials option: %s", key)
+		}
+	}
+	return c.validate()
+}
+
+// validate rejects credentials that would accept any password.
+func (c *Credentials) validate() error {
+	if len(c.Users) == 0 && c.Htpasswd == "" {
+		return fmt.Errorf("credentials require users or an htpasswd file")
+	}
+	return nil
+}
+
+// Load reads the htpasswd file, if any, resolving it relative to dir. The
+// resolved filename is returned so that it can be watched for changes.
+func (c *Credentials) Load(dir string) (string, error) {
+	if c.Htpasswd == "" {
+		return "", nil
+	}
+	filename := c.Htpasswd
+	if !filepath.IsAbs(filename) {
+		filename = filepath.Join(dir, filename)
+	}
+	bs, err := os.ReadFile(filename)
+	if err != nil {
+		return filename, fmt.Errorf("unable to read htpasswd file %s: %w", filename, err)
+	}
+	users, err := parseHtpasswd(bs)
+	if err != nil {
+		return filename, fmt.Errorf("unable to parse htpasswd file %s: %w", filename, err)
+	}
+	c.file = users
+	return filename, nil
+}
+
+func parseHtpasswd(bs []byte) (map[string]string, error) {
+	users := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(bs))
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		parts := strings.SplitN(text, ":", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("line %d: expected user:hash", line)
+		}
+		users[parts[0]] = parts[1]
+	}
+	return users, scanner.Err()
+}
+
+func (c *Credentials) lookup(username string) (string, bool) {
+	if password, ok := c.Users[username]; ok {
+		return password, true
+	}
+	password, ok := c.file[username]
+	return password, ok
+}
+
+func (c *Credentials) Authorized(r *http.Request) (Claims, error) {
+	auth := r.Header.Get("Authorization")
+	if auth == "" || !strings.HasPrefix(auth, "Basic ") {
+		return Claims{}, fmt.Errorf("basic credentials %w", ErrMissing)
+	}
+
+	username, password, err := extractCredentials(auth[6:])
+	if err != nil {
+		return Claims{}, err
+	}
+	claims := Claims{"username": username}
+
+	stored, ok := c.lookup(username)
+	if !ok {
+		return claims, fmt.Errorf("unknown user: %s", username)
+	}
+	if !verifyPassword(stored, password) {
+		return claims, fmt.Errorf("invalid password for user: %s", username)
+	}
+
+	return claims, forbidden(validate(c.Claims, claims))
+}
+
+// extractCredentials decodes an RFC 7617 user-pass. The user-id cannot contain
+// a colon, so everything after the first one belongs to the password.
+func extractCredentials(credentials string) (string, string, error) {
+	credentials = strings.TrimSpace(credentials)
+	bs, err := base64.StdEncoding.DecodeString(credentials)
+	if err != nil {
+		var e2 error
+		if bs, e2 = base64.RawStdEncoding.DecodeString(credentials); e2 != nil {
+			if bs, e2 = base64.URLEncoding.DecodeString(credentials); e2 != nil {
+				return "", "", fmt.Errorf("unable to decode credentials: %w", err)
+			}
+		}
+	}
+
+	parts := strings.SplitN(string(bs), ":", 2)
+	if len(parts) != 2 {
+		return "", "", fmt.Errorf("malformed credentials: missing ':' separator")
+	}
+	return parts[0], parts[1], nil
+}
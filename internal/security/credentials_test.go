@@ -0,0 +1,132 @@
+package security
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+const htpasswd = `# users
+ann:$apr1$r31.....$HqJZimcKQFAMYayBlzkrA/
+
+bob:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=
+cy:$5$saltstring$5B8vYYiY.CVt1RlTTf8KbXBH3hsxY/GNooZaBBGWEc5
+`
+
+func TestParseHtpasswd(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		users map[string]string
+		err   string
+	}{
+		{"entries", htpasswd, map[string]string{
+			"ann": "$apr1$r31.....$HqJZimcKQFAMYayBlzkrA/",
+			"bob": "{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=",
+			"cy":  "$5$saltstring$5B8vYYiY.CVt1RlTTf8KbXBH3hsxY/GNooZaBBGWEc5",
+		}, ""},
+		{"colon in hash", "ann:a:b\n", map[string]string{"ann": "a:b"}, ""},
+		{"no separator", "ann\n", nil, "line 1: expected user:hash"},
+		{"no user", ":hash\n", nil, "line 1: expected user:hash"},
+		{"no hash", "# users\nann:\n", nil, "line 2: expected user:hash"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users, err := parseHtpasswd([]byte(tt.input))
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Errorf("error = %v, want %s", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(users) != len(tt.users) {
+				t.Errorf("users = %v, want %v", users, tt.users)
+			}
+			for user, hash := range tt.users {
+				if users[user] != hash {
+					t.Errorf("user %s = %q, want %q", user, users[user], hash)
+				}
+			}
+		})
+	}
+}
+
+func TestCredentials(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "users.htpasswd"), []byte(htpasswd), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		config   string
+		user     string
+		password string
+		err      string
+	}{
+		{"bare map", `{jason: figge, bob: pw}`, "bob", "pw", ""},
+		{"bare map wrong password", `{jason: figge}`, "jason", "x", "invalid password for user: jason"},
+		{"bare map unknown user", `{jason: figge}`, "bob", "figge", "unknown user: bob"},
+		{"users", `{users: {jason: "$1$saltstri$YMyguxXMBpd2TEZ.vS/3q1"}}`, "jason", "Hello world!", ""},
+		{"htpasswd", `{htpasswd: users.htpasswd}`, "ann", "myPassword", ""},
+		{"htpasswd sha", `{htpasswd: users.htpasswd}`, "bob", "password", ""},
+		{"users before htpasswd", `{users: {ann: pw}, htpasswd: users.htpasswd}`, "ann", "pw", ""},
+		{"claims", `{users: {jason: figge}, claims: {username: jason}}`, "jason", "figge", ""},
+		{"claims refused", `{users: {jason: figge, bob: pw}, claims: {username: jason}}`, "bob", "pw", `claim username: expected "jason", got "bob"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var c Credentials
+			if err := yaml.Unmarshal([]byte(tt.config), &c); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := c.Load(dir); err != nil {
+				t.Fatal(err)
+			}
+			r, _ := http.NewRequest(http.MethodGet, "/", nil)
+			r.SetBasicAuth(tt.user, tt.password)
+			claims, err := c.Authorized(r)
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if claims["username"] != tt.user {
+					t.Errorf("username = %v, want %s", claims["username"], tt.user)
+				}
+			} else if err == nil || err.Error() != tt.err {
+				t.Errorf("error = %v, want %s", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestInvalidCredentials(t *testing.T) {
+	tests := []struct {
+		config string
+		err    string
+	}{
+		{`{}`, "credentials require users or an htpasswd file"},
+		{`{claims: {username: jason}}`, "credentials require users or an htpasswd file"},
+		{`{users: {jason: ""}}`, "credentials user jason must have a password"},
+		{`{users: {jason: }}`, "credentials user jason must have a password"},
+		{`{jason: ""}`, "credentials user jason must have a password"},
+		{`{username: {eq: jason}}`, "credentials user username must have a password"},
+		{`{users: [jason]}`, "credentials users must be a map of user: password"},
+		{`{users: {jason: figge}, realm: x}`, "unknown credentials option: realm"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.config, func(t *testing.T) {
+			var c Credentials
+			err := yaml.Unmarshal([]byte(tt.config), &c)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("error = %v, want %s", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package security
+
+import "errors"
+
+// ErrMissing reports that the request carried no credentials for a scheme, as
+// opposed to credentials that were present but invalid.
+var ErrMissing = errors.New("missing")
+
+// ForbiddenError reports credentials that were valid but whose claims did not
+// satisfy the configured rules.
+type ForbiddenError struct {
+	err error
+}
+
+func (e *ForbiddenError) Error() string {
+	return e.err.Error()
+}
+
+func (e *ForbiddenError) Unwrap() error {
+	return e.err
+}
+
+func IsForbidden(err error) bool {
+	var f *ForbiddenError
+	return errors.As(err, &f)
+}
+
+func forbidden(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &ForbiddenError{err: err}
+}
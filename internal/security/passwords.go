@@ -0,0 +1,244 @@
+package security
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"hash"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const cryptAlphabet = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+var (
+	sha256Order = [][3]int{
+		{0, 10, 20}, {21, 1, 11}, {12, 22, 2}, {3, 13, 23}, {24, 4, 14},
+		{15, 25, 5}, {6, 16, 26}, {27, 7, 17}, {18, 28, 8}, {9, 19, 29},
+	}
+	sha512Order = [][3]int{
+		{0, 21, 42}, {22, 43, 1}, {44, 2, 23}, {3, 24, 45}, {25, 46, 4},
+		{47, 5, 26}, {6, 27, 48}, {28, 49, 7}, {50, 8, 29}, {9, 30, 51},
+		{31, 52, 10}, {53, 11, 32}, {12, 33, 54}, {34, 55, 13}, {56, 14, 35},
+		{15, 36, 57}, {37, 58, 16}, {59, 17, 38}, {18, 39, 60}, {40, 61, 19},
+		{62, 20, 41},
+	}
+)
+
+// verifyPassword checks a password against a stored value, which may be a
+// bcrypt ($2a$, $2b$, $2y$), SHA-crypt ($5$, $6$), MD5-crypt ($1$, $apr1$) or
+// {SHA} hash as produced by htpasswd. Anything else is compared as plaintext.
+func verifyPassword(stored, password string) bool {
+	var computed string
+	switch {
+	case strings.HasPrefix(stored, "$2a$"), strings.HasPrefix(stored, "$2b$"), strings.HasPrefix(stored, "$2y$"):
+		return bcrypt.CompareHashAndPassword([]byte(stored), []byte(password)) == nil
+	case strings.HasPrefix(stored, "$5$"):
+		computed = shaCrypt(sha256.New, "$5$", sha256Order, []int{0, 31, 30}, password, stored)
+	case strings.HasPrefix(stored, "$6$"):
+		computed = shaCrypt(sha512.New, "$6$", sha512Order, []int{0, 0, 63}, password, stored)
+	case strings.HasPrefix(stored, "$apr1$"):
+		computed = md5Crypt("$apr1$", password, stored)
+	case strings.HasPrefix(stored, "$1$"):
+		computed = md5Crypt("$1$", password, stored)
+	case strings.HasPrefix(stored, "{SHA}"):
+		sum := sha1.Sum([]byte(password))
+		computed = "{SHA}" + base64.StdEncoding.EncodeToString(sum[:])
+	default:
+		computed = password
+	}
+	return subtle.ConstantTimeCompare([]byte(stored), []byte(computed)) == 1
+}
+
+func shaCrypt(newHash func() hash.Hash, magic string, order [][3]int, last []int, password, setting string) string {
+	pw := []byte(password)
+	rest := strings.TrimPrefix(setting, magic)
+	rounds, customRounds := 5000, false
+	if strings.HasPrefix(rest, "rounds=") {
+		end := strings.IndexByte(rest, '$')
+		if end < 0 {
+			return ""
+		}
+		n, err := strconv.Atoi(rest[len("rounds="):end])
+		if err != nil {
+			return ""
+		}
+		rounds, customRounds = n, true
+		if rounds < 1000 {
+			rounds = 1000
+		} else if rounds > 999999999 {
+			rounds = 999999999
+		}
+		rest = rest[end+1:]
+	}
+	salt := rest
+	if i := strings.IndexByte(salt, '$'); i >= 0 {
+		salt = salt[:i]
+	}
+	if len(salt) > 16 {
+		salt = salt[:16]
+	}
+	s := []byte(salt)
+
+	h := newHash()
+	h.Write(pw)
+	h.Write(s)
+	h.Write(pw)
+	b := h.Sum(nil)
+	size := len(b)
+
+	h = newHash()
+	h.Write(pw)
+	h.Write(s)
+	h.Write(repeat(b, len(pw)))
+	for i := len(pw); i > 0; i >>= 1 {
+		if i&1 != 0 {
+			h.Write(b)
+		} else {
+			h.Write(pw)
+		}
+	}
+	a := h.Sum(nil)
+
+	h = newHash()
+	for i := 0; i < len(pw); i++ {
+		h.Write(pw)
+	}
+	p := repeat(h.Sum(nil), len(pw))
+
+	h = newHash()
+	for i := 0; i < 16+int(a[0]); i++ {
+		h.Write(s)
+	}
+	ds := repeat(h.Sum(nil), len(s))
+
+	c := a
+	for i := 0; i < rounds; i++ {
+		h = newHash()
+		if i&1 != 0 {
+			h.Write(p)
+		} else {
+			h.Write(c)
+		}
+		if i%3 != 0 {
+			h.Write(ds)
+		}
+		if i%7 != 0 {
+			h.Write(p)
+		}
+		if i&1 != 0 {
+			h.Write(c)
+		} else {
+			h.Write(p)
+		}
+		c = h.Sum(nil)
+	}
+
+	var out bytes.Buffer
+	out.WriteString(magic)
+	if customRounds {
+		out.WriteString("rounds=" + strconv.Itoa(rounds) + "$")
+	}
+	out.Write(s)
+	out.WriteByte('$')
+	for _, o := range order {
+		encode24(&out, c[o[0]], c[o[1]], c[o[2]], 4)
+	}
+	if size == sha256.Size {
+		encode24(&out, 0, c[last[1]], c[last[2]], 3)
+	} else {
+		encode24(&out, 0, 0, c[last[2]], 2)
+	}
+	return out.String()
+}
+
+func md5Crypt(magic, password, setting string) string {
+	pw := []byte(password)
+	salt := strings.TrimPrefix(setting, magic)
+	if i := strings.IndexByte(salt, '$'); i >= 0 {
+		salt = salt[:i]
+	}
+	if len(salt) > 8 {
+		salt = salt[:8]
+	}
+	s := []byte(salt)
+
+	h := md5.New()
+	h.Write(pw)
+	h.Write(s)
+	h.Write(pw)
+	final := h.Sum(nil)
+
+	h = md5.New()
+	h.Write(pw)
+	h.Write([]byte(magic))
+	h.Write(s)
+	h.Write(repeat(final, len(pw)))
+	for i := len(pw); i != 0; i >>= 1 {
+		if i&1 != 0 {
+			h.Write([]byte{0})
+		} else if len(pw) > 0 {
+			h.Write(pw[:1])
+		}
+	}
+	final = h.Sum(nil)
+
+	for i := 0; i < 1000; i++ {
+		h = md5.New()
+		if i&1 != 0 {
+			h.Write(pw)
+		} else {
+			h.Write(final)
+		}
+		if i%3 != 0 {
+			h.Write(s)
+		}
+		if i%7 != 0 {
+			h.Write(pw)
+		}
+		if i&1 != 0 {
+			h.Write(final)
+		} else {
+			h.Write(pw)
+		}
+		final = h.Sum(nil)
+	}
+
+	var out bytes.Buffer
+	out.WriteString(magic)
+	out.Write(s)
+	out.WriteByte('$')
+	encode24(&out, final[0], final[6], final[12], 4)
+	encode24(&out, final[1], final[7], final[13], 4)
+	encode24(&out, final[2], final[8], final[14], 4)
+	encode24(&out, final[3], final[9], final[15], 4)
+	encode24(&out, final[4], final[10], final[5], 4)
+	encode24(&out, 0, 0, final[11], 2)
+	return out.String()
+}
+
+func repeat(b []byte, length int) []byte {
+	out := make([]byte, 0, length)
+	for len(out) < length {
+		n := length - len(out)
+		if n > len(b) {
+			n = len(b)
+		}
+		out = append(out, b[:n]...)
+	}
+	return out
+}
+
+func encode24(out *bytes.Buffer, b2, b1, b0 byte, n int) {
+	w := uint(b2)<<16 | uint(b1)<<8 | uint(b0)
+	for ; n > 0; n-- {
+		out.WriteByte(cryptAlphabet[w&0x3f])
+		w >>= 6
+	}
+}
@@ -0,0 +1,40 @@
+package security
+
+import "testing"
+
+func TestVerifyPassword(t *testing.T) {
+	tests := []struct {
+		name     string
+		stored   string
+		password string
+		want     bool
+	}{
+		{"bcrypt 2a", "$2a$05$CCCCCCCCCCCCCCCCCCCCC.E5YPO9kmyuRGyh0XouQYb4YMJKvyOeW", "U*U", true},
+		{"bcrypt 2a wrong", "$2a$05$CCCCCCCCCCCCCCCCCCCCC.E5YPO9kmyuRGyh0XouQYb4YMJKvyOeW", "U*V", false},
+		{"bcrypt 2b", "$2b$05$CCCCCCCCCCCCCCCCCCCCC.E5YPO9kmyuRGyh0XouQYb4YMJKvyOeW", "U*U", true},
+		{"bcrypt 2y", "$2y$05$CCCCCCCCCCCCCCCCCCCCC.E5YPO9kmyuRGyh0XouQYb4YMJKvyOeW", "U*U", true},
+		{"sha256", "$5$saltstring$5B8vYYiY.CVt1RlTTf8KbXBH3hsxY/GNooZaBBGWEc5", "Hello world!", true},
+		{"sha256 wrong", "$5$saltstring$5B8vYYiY.CVt1RlTTf8KbXBH3hsxY/GNooZaBBGWEc5", "hello world!", false},
+		{"sha256 rounds", "$5$rounds=10000$saltstringsaltst$3xv.VbSHBb41AL9AvLeujZkZRBAwqFMz2.opqey6IcA", "Hello world!", true},
+		{"sha256 bad rounds", "$5$rounds=x$saltstring$5B8vYYiY.CVt1RlTTf8KbXBH3hsxY/GNooZaBBGWEc5", "Hello world!", false},
+		{"sha512", "$6$saltstring$svn8UoSVapNtMuq1ukKS4tPQd8iKwSMHWjl/O817G3uBnIFNjnQJuesI68u4OTLiBFdcbYEdFCoEOfaS35inz1", "Hello world!", true},
+		{"sha512 rounds", "$6$rounds=10000$saltstringsaltst$OW1/O6BYHV6BcXZu8QVeXbDWra3Oeqh0sbHbbMCVNSnCM/UrjmM0Dp8vOuZeHBy/YTBmSK6H9qs/y3RnOaw5v.", "Hello world!", true},
+		{"md5", "$1$saltstri$YMyguxXMBpd2TEZ.vS/3q1", "Hello world!", true},
+		{"md5 wrong", "$1$saltstri$YMyguxXMBpd2TEZ.vS/3q1", "Hello world", false},
+		{"md5 empty salt", "$1$$LP5.V3ajGqHDdXW6XwZQy.", "x", true},
+		{"apr1", "$apr1$saltstri$aGfuB7Lcvs2TUeFTqUVfN0", "Hello world!", true},
+		{"apr1 apache", "$apr1$r31.....$HqJZimcKQFAMYayBlzkrA/", "myPassword", true},
+		{"sha1", "{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=", "password", true},
+		{"sha1 wrong", "{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=", "Password", false},
+		{"plaintext", "figge", "figge", true},
+		{"plaintext wrong", "figge", "figgE", false},
+		{"plaintext hash prefix", "$5$", "$5$", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := verifyPassword(tt.stored, tt.password); got != tt.want {
+				t.Errorf("verifyPassword(%q, %q) = %t, want %t", tt.stored, tt.password, got, tt.want)
+			}
+		})
+	}
+}
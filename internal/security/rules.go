@@ -0,0 +1,355 @@
+package security
+
+import (
+	"fmt"
+	"path"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Rule operators recognised when a claim check is expressed as a map, e.g.
+//
+//	realm_access.roles:
+//	  any: [admin, owner]
+//	age:
+//	  gte: 18
+//	email:
+//	  not:
+//	    glob: "*@example.com"
+const (
+	opAny    = "any"
+	opAll    = "all"
+	opNone   = "none"
+	opEq     = "eq"
+	opNe     = "ne"
+	opGt     = "gt"
+	opGte    = "gte"
+	opLt     = "lt"
+	opLte    = "lte"
+	opRegex  = "regex"
+	opGlob   = "glob"
+	opExists = "exists"
+	opNot    = "not"
+)
+
+var (
+	operators = map[string]bool{
+		opAny: true, opAll: true, opNone: true,
+		opEq: true, opNe: true, opGt: true, opGte: true, opLt: true, opLte: true,
+		opRegex: true, opGlob: true, opExists: true, opNot: true,
+	}
+	regexCache sync.Map
+)
+
+func validate(checks Claims, claims Claims) error {
+	return checkClaims("", checks, claims)
+}
+
+func checkClaims(prefix string, checks map[string]interface{}, claims map[string]interface{}) error {
+	for _, key := range sortedKeys(checks) {
+		expected := checks[key]
+		name := key
+		if prefix != "" {
+			name = fmt.Sprintf("%s.%s", prefix, key)
+		}
+		actual, found := lookup(claims, key)
+		if err := checkValue(name, expected, actual, found); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lookup resolves a dotted claim path such as realm_access.roles. A claim whose
+// name itself contains dots takes precedence over descending into objects.
+func lookup(claims map[string]interface{}, key string) (interface{}, bool) {
+	if v, ok := claims[key]; ok {
+		return v, true
+	}
+	parts := strings.Split(key, ".")
+	for i := len(parts) - 1; i > 0; i-- {
+		head := strings.Join(parts[:i], ".")
+		v, ok := claims[head]
+		if !ok {
+			continue
+		}
+		if m, ok := asMap(v); ok {
+			return lookup(m, strings.Join(parts[i:], "."))
+		}
+		return nil, false
+	}
+	return nil, false
+}
+
+func checkValue(name string, expected, actual interface{}, found bool) error {
+	if rules, ok := asMap(expected); ok {
+		if !isOperatorMap(rules) {
+			if !found {
+				return fmt.Errorf("claim %s: missing", name)
+			}
+			nested, ok := asMap(actual)
+			if !ok {
+				return fmt.Errorf("claim %s: expected an object, got %s", name, describe(actual))
+			}
+			return checkClaims(name, rules, nested)
+		}
+		for _, op := range sortedKeys(rules) {
+			if err := checkOperator(name, op, rules[op], actual, found); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if !found {
+		return fmt.Errorf("claim %s: missing", name)
+	}
+	if list, ok := asList(expected); ok {
+		if len(list) == 0 {
+			return fmt.Errorf("claim %s: empty rule list", name)
+		}
+		return checkAll(name, list, actual)
+	}
+	if !containsOrEquals(actual, expected) {
+		return fmt.Errorf("claim %s: expected %s, got %s", name, describe(expected), describe(actual))
+	}
+	return nil
+}
+
+func checkOperator(name, op string, operand, actual interface{}, found bool) error {
+	if op == opExists {
+		want, _ := operand.(bool)
+		if want != found {
+			if want {
+				return fmt.Errorf("claim %s: missing", name)
+			}
+			return fmt.Errorf("claim %s: must not be present", name)
+		}
+		return nil
+	}
+	if op == opNot {
+		if err := checkValue(name, operand, actual, found); err == nil {
+			return fmt.Errorf("claim %s: must not match %s", name, describe(operand))
+		}
+		return nil
+	}
+	if !found {
+		return fmt.Errorf("claim %s: missing", name)
+	}
+
+	switch op {
+	case opAll:
+		list, _ := asList(operand)
+		return checkAll(name, list, actual)
+	case opAny:
+		list, _ := asList(operand)
+		for _, v := range list {
+			if containsOrEquals(actual, v) {
+				return nil
+			}
+		}
+		return fmt.Errorf("claim %s: expected any of %s, got %s", name, describe(list), describe(actual))
+	case opNone:
+		list, _ := asList(operand)
+		for _, v := range list {
+			if containsOrEquals(actual, v) {
+				return fmt.Errorf("claim %s: must not contain %s", name, describe(v))
+			}
+		}
+		return nil
+	case opEq:
+		if !equals(actual, operand) {
+			return fmt.Errorf("claim %s: expected %s, got %s", name, describe(operand), describe(actual))
+		}
+		return nil
+	case opNe:
+		if equals(actual, operand) {
+			return fmt.Errorf("claim %s: must not equal %s", name, describe(operand))
+		}
+		return nil
+	case opGt, opGte, opLt, opLte:
+		return compare(name, op, operand, actual)
+	case opRegex:
+		pattern := fmt.Sprint(operand)
+		re, err := compileRegex(pattern)
+		if err != nil {
+			return fmt.Errorf("claim %s: invalid regex %q: %v", name, pattern, err)
+		}
+		if !anyString(actual, re.MatchString) {
+			return fmt.Errorf("claim %s: %s does not match regex %q", name, describe(actual), pattern)
+		}
+		return nil
+	case opGlob:
+		pattern := fmt.Sprint(operand)
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("claim %s: invalid glob %q: %v", name, pattern, err)
+		}
+		matched := anyString(actual, func(s string) bool {
+			ok, _ := path.Match(pattern, s)
+			return ok
+		})
+		if !matched {
+			return fmt.Errorf("claim %s: %s does not match glob %q", name, describe(actual), pattern)
+		}
+		return nil
+	}
+	return fmt.Errorf("claim %s: unknown operator %q", name, op)
+}
+
+func checkAll(name string, expected []interface{}, actual interface{}) error {
+	for _, v := range expected {
+		if !containsOrEquals(actual, v) {
+			return fmt.Errorf("claim %s: expected all of %s, got %s", name, describe(expected), describe(actual))
+		}
+	}
+	return nil
+}
+
+func compare(name, op string, operand, actual interface{}) error {
+	want, ok := toFloat(operand)
+	if !ok {
+		return fmt.Errorf("claim %s: %s requires a number, got %s", name, op, describe(operand))
+	}
+	got, ok := toFloat(actual)
+	if !ok {
+		return fmt.Errorf("claim %s: expected a number, got %s", name, describe(actual))
+	}
+	var passed bool
+	switch op {
+	case opGt:
+		passed = got > want
+	case opGte:
+		passed = got >= want
+	case opLt:
+		passed = got < want
+	case opLte:
+		passed = got <= want
+	}
+	if !passed {
+		return fmt.Errorf("claim %s: expected %s %v, got %v", name, op, operand, actual)
+	}
+	return nil
+}
+
+func isOperatorMap(m map[string]interface{}) bool {
+	for k := range m {
+		if !operators[k] {
+			return false
+		}
+	}
+	return len(m) > 0
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func containsOrEquals(actual, expected interface{}) bool {
+	if list, ok := asList(actual); ok {
+		return openArray(list).contains(expected)
+	}
+	return equals(actual, expected)
+}
+
+func equals(a, b interface{}) bool {
+	if fa, ok := toFloat(a); ok {
+		fb, ok := toFloat(b)
+		return ok && fa == fb
+	}
+	switch av := a.(type) {
+	case string:
+		bv, ok := b.(string)
+		return ok && av == bv
+	case bool:
+		bv, ok := b.(bool)
+		return ok && av == bv
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func anyString(actual interface{}, match func(string) bool) bool {
+	if list, ok := asList(actual); ok {
+		for _, v := range list {
+			if s, ok := v.(string); ok && match(s) {
+				return true
+			}
+		}
+		return false
+	}
+	s, ok := actual.(string)
+	return ok && match(s)
+}
+
+func compileRegex(pattern string) (*regexp.Regexp, error) {
+	if re, ok := regexCache.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	regexCache.Store(pattern, re)
+	return re, nil
+}
+
+func asMap(v interface{}) (map[string]interface{}, bool) {
+	switch m := v.(type) {
+	case map[string]interface{}:
+		return m, true
+	case Claims:
+		return m, true
+	}
+	return nil, false
+}
+
+func asList(v interface{}) ([]interface{}, bool) {
+	switch l := v.(type) {
+	case []interface{}:
+		return l, true
+	case openArray:
+		return l, true
+	case []string:
+		list := make([]interface{}, len(l))
+		for i, s := range l {
+			list[i] = s
+		}
+		return list, true
+	}
+	return nil, false
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+func describe(v interface{}) string {
+	switch x := v.(type) {
+	case string:
+		return fmt.Sprintf("%q", x)
+	case nil:
+		return "null"
+	}
+	return fmt.Sprintf("%v", v)
+}
@@ -0,0 +1,84 @@
+package security
+
+import (
+	"encoding/json"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+const ruleClaims = `{
+	"sub": "jason",
+	"email": "jason@example.com",
+	"age": 30,
+	"verified": true,
+	"groups": ["staff", "dev"],
+	"realm_access": {"roles": ["admin", "owner"]},
+	"https://example.com/tenant": "acme",
+	"scope.read": "yes"
+}`
+
+func TestValidate(t *testing.T) {
+	var claims Claims
+	if err := json.Unmarshal([]byte(ruleClaims), &claims); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		checks string
+		err    string
+	}{
+		{`sub: jason`, ""},
+		{`sub: bob`, `claim sub: expected "bob", got "jason"`},
+		{`missing: x`, `claim missing: missing`},
+		{`age: 30`, ""},
+		{`verified: true`, ""},
+		{`groups: staff`, ""},
+		{`groups: [staff, dev]`, ""},
+		{`groups: [staff, ops]`, `claim groups: expected all of [staff ops], got [staff dev]`},
+		{`groups: []`, `claim groups: empty rule list`},
+		{`realm_access.roles: {any: [admin, viewer]}`, ""},
+		{`realm_access.roles: {any: [viewer]}`, `claim realm_access.roles: expected any of [viewer], got [admin owner]`},
+		{`realm_access.roles: {all: [admin, owner]}`, ""},
+		{`realm_access.roles: {none: [banned]}`, ""},
+		{`realm_access.roles: {none: [owner]}`, `claim realm_access.roles: must not contain "owner"`},
+		{`realm_access: {roles: admin}`, ""},
+		{`sub: {roles: admin}`, `claim sub: expected an object, got "jason"`},
+		{`scope.read: "yes"`, ""},
+		{`"https://example.com/tenant": acme`, ""},
+		{`age: {gte: 18, lt: 65}`, ""},
+		{`age: {gt: 30}`, `claim age: expected gt 30, got 30`},
+		{`age: {lte: "old"}`, `claim age: lte requires a number, got "old"`},
+		{`sub: {gt: 1}`, `claim sub: expected a number, got "jason"`},
+		{`age: {eq: 30}`, ""},
+		{`age: {ne: 30}`, `claim age: must not equal 30`},
+		{`email: {glob: "*@example.com"}`, ""},
+		{`email: {not: {glob: "*@example.com"}}`, `claim email: must not match map[glob:*@example.com]`},
+		{`email: {glob: "["}`, `claim email: invalid glob "[": syntax error in pattern`},
+		{`groups: {regex: "^d"}`, ""},
+		{`email: {regex: "^bob@"}`, `claim email: "jason@example.com" does not match regex "^bob@"`},
+		{`email: {regex: "("}`, "claim email: invalid regex \"(\": error parsing regexp: missing closing ): `(`"},
+		{`phone: {exists: false}`, ""},
+		{`phone: {exists: true}`, `claim phone: missing`},
+		{`sub: {exists: false}`, `claim sub: must not be present`},
+		{`phone: {not: {exists: true}}`, ""},
+		{`phone: {eq: 1}`, `claim phone: missing`},
+		{`sub: {like: x}`, `claim sub: expected an object, got "jason"`},
+		{`sub: {eq: jason, like: x}`, `claim sub: expected an object, got "jason"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.checks, func(t *testing.T) {
+			var checks Claims
+			if err := yaml.Unmarshal([]byte(tt.checks), &checks); err != nil {
+				t.Fatal(err)
+			}
+			err := validate(checks, claims)
+			if tt.err == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+			} else if err == nil || err.Error() != tt.err {
+				t.Errorf("error = %v, want %s", err, tt.err)
+			}
+		})
+	}
+}
@@ -19,7 +19,7 @@ func main() {
 	}()
 
 	filename := "source"
-	if len(os.Args) == 2 {
+	if len(os.Args) >= 2 {
 		filename = os.Args[1]
 	}
 
@@ -29,14 +29,37 @@ func main() {
 		fmt.Printf("Usage: %s source.json\n", os.Args[0])
 		fmt.Println("      --help prints this message")
 		fmt.Println("      --example creates an example file sourcex.yaml")
+		fmt.Println("      --export [source] [file] writes the source with its storage data replaced by the")
+		fmt.Println("               persisted rows to file, or to stdout")
 	} else if filename == "--example" || filename == "-e" {
 		err := os.WriteFile("example.yaml", []byte(example), 0644)
 		if err != nil {
 			log.Fatalf("unable to write example: %v", err)
 		}
 		fmt.Println("See example.yaml")
+	} else if filename == "--export" || filename == "-x" {
+		exportSource(os.Args[2:])
 	} else {
 		app := internal.NewApp(filename)
 		app.Serve()
 	}
 }
+
+func exportSource(args []string) {
+	filename := "source"
+	if len(args) > 0 {
+		filename = args[0]
+	}
+	out := os.Stdout
+	if len(args) > 1 {
+		f, err := os.Create(args[1])
+		if err != nil {
+			log.Fatalf("unable to write export: %v", err)
+		}
+		defer func() { _ = f.Close() }()
+		out = f
+	}
+	if err := internal.Export(filename, out); err != nil {
+		log.Fatalf("unable to export %s: %v", filename, err)
+	}
+}